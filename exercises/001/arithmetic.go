@@ -0,0 +1,355 @@
+package main
+
+/*
+算術エンジン
+
+div() だけを論理演算で組み合わせた述語は、各 div の約数の最小公倍数を周期とする周期的な条件になります。
+このような述語について、包除原理を使って範囲を1つずつ調べることなく
+件数・合計・n番目の値・ページ単位の一覧を求めます。
+
+条件 div(d1)..div(dk) の真偽の組み合わせ T ごとに述語の値 f(T) を求め、
+メビウス変換で係数 c(U) に変換すると、
+
+	count(lo..hi) = Σ_U c(U) × |{ x ∈ [lo, hi] : lcm(U) | x }|
+
+となります（U は条件の部分集合）。
+*/
+
+import (
+	"errors"
+	"iter"
+	"math"
+	"math/big"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrNotArithmetic は、述語に div 以外の関数が含まれるときのエラー
+	ErrNotArithmetic = errors.New("predicate uses conditions other than div()")
+	// ErrTooManyConditions は、div の種類が多すぎて包除原理が使えないときのエラー
+	ErrTooManyConditions = errors.New("predicate has too many distinct div() conditions")
+	// ErrOverflow は、結果が int64 に収まらないときのエラー
+	ErrOverflow = errors.New("result overflows int64")
+)
+
+const (
+	// maxArithmeticConditions は、包除原理で扱う div の種類の上限（2^k 項になる）
+	maxArithmeticConditions = 16
+	// maxResidueTable は、一覧表示で剰余表を作る周期の上限
+	maxResidueTable = 1 << 20
+)
+
+// term は、包除原理の1項（係数と最小公倍数）
+type term struct {
+	coef int64
+	lcm  *big.Int
+}
+
+// Arithmetic は、div の組み合わせからなる述語を範囲を走査せずに評価する
+type Arithmetic struct {
+	pred   *Predicate
+	terms  []term
+	period *big.Int // 全ての約数の最小公倍数
+
+	tableOnce sync.Once
+	residues  []uint64 // 周期内で条件を満たす剰余（周期が大きいときは nil）
+}
+
+// NewArithmetic は、述語から Arithmetic を作成する
+func NewArithmetic(p *Predicate) (*Arithmetic, error) {
+	// 1. 述語に含まれる div の約数を重複なく集める
+	var divisors []int64
+	index := map[int64]int{}
+	var collect func(n node) error
+	collect = func(n node) error {
+		switch n := n.(type) {
+		case *orNode:
+			if err := collect(n.left); err != nil {
+				return err
+			}
+			return collect(n.right)
+		case *andNode:
+			if err := collect(n.left); err != nil {
+				return err
+			}
+			return collect(n.right)
+		case *notNode:
+			return collect(n.operand)
+		case *constNode:
+			return nil
+		case *callNode:
+			if n.name != "div" {
+				return ErrNotArithmetic
+			}
+			if _, ok := index[n.args[0]]; !ok {
+				index[n.args[0]] = len(divisors)
+				divisors = append(divisors, n.args[0])
+			}
+			return nil
+		}
+		return ErrNotArithmetic
+	}
+	if err := collect(p.root); err != nil {
+		return nil, err
+	}
+	if len(divisors) > maxArithmeticConditions {
+		return nil, ErrTooManyConditions
+	}
+
+	// 2. 真偽の組み合わせごとに述語を評価し、メビウス変換で係数にする
+	size := 1 << len(divisors)
+	coef := make([]int64, size)
+	for mask := range size {
+		if evalMask(p.root, index, mask) {
+			coef[mask] = 1
+		}
+	}
+	for bit := 1; bit < size; bit <<= 1 {
+		for mask := range size {
+			if mask&bit != 0 {
+				coef[mask] -= coef[mask^bit]
+			}
+		}
+	}
+
+	// 3. 係数が 0 でない項だけを残す
+	a := &Arithmetic{pred: p, period: big.NewInt(1)}
+	lcms := make([]*big.Int, size)
+	lcms[0] = big.NewInt(1)
+	for mask := 1; mask < size; mask++ {
+		low := mask & -mask
+		i := 0
+		for 1<<i != low {
+			i++
+		}
+		lcms[mask] = lcm(lcms[mask^low], big.NewInt(divisors[i]))
+	}
+	for mask, c := range coef {
+		if c != 0 {
+			a.terms = append(a.terms, term{coef: c, lcm: lcms[mask]})
+		}
+	}
+	a.period = lcms[size-1]
+	return a, nil
+}
+
+// evalMask は、mask のビットを各 div の真偽として述語を評価する
+func evalMask(n node, index map[int64]int, mask int) bool {
+	switch n := n.(type) {
+	case *orNode:
+		return evalMask(n.left, index, mask) || evalMask(n.right, index, mask)
+	case *andNode:
+		return evalMask(n.left, index, mask) && evalMask(n.right, index, mask)
+	case *notNode:
+		return !evalMask(n.operand, index, mask)
+	case *constNode:
+		return n.value
+	case *callNode:
+		return mask&(1<<index[n.args[0]]) != 0
+	}
+	return false
+}
+
+// lcm は、a と b の最小公倍数を返す
+func lcm(a, b *big.Int) *big.Int {
+	g := new(big.Int).GCD(nil, nil, a, b)
+	r := new(big.Int).Div(a, g)
+	return r.Mul(r, b)
+}
+
+// Period は、述語の周期（全ての約数の最小公倍数）を返す
+func (a *Arithmetic) Period() *big.Int {
+	return new(big.Int).Set(a.period)
+}
+
+// CountBig は、[lo, hi] で条件を満たす整数の個数を返す
+func (a *Arithmetic) CountBig(lo, hi *big.Int) *big.Int {
+	total := new(big.Int)
+	if lo.Cmp(hi) > 0 {
+		return total
+	}
+	below := new(big.Int).Sub(lo, big.NewInt(1))
+	q1, q0, t := new(big.Int), new(big.Int), new(big.Int)
+	for _, tm := range a.terms {
+		// lcm の倍数の個数 = floor(hi/L) - floor((lo-1)/L)
+		// （big.Int.Div は除数が正のとき床関数になる）
+		q1.Div(hi, tm.lcm)
+		q0.Div(below, tm.lcm)
+		t.Sub(q1, q0)
+		t.Mul(t, big.NewInt(tm.coef))
+		total.Add(total, t)
+	}
+	return total
+}
+
+// SumBig は、[lo, hi] で条件を満たす整数の合計を返す
+func (a *Arithmetic) SumBig(lo, hi *big.Int) *big.Int {
+	total := new(big.Int)
+	if lo.Cmp(hi) > 0 {
+		return total
+	}
+	below := new(big.Int).Sub(lo, big.NewInt(1))
+	q1, q0, t := new(big.Int), new(big.Int), new(big.Int)
+	for _, tm := range a.terms {
+		// L の倍数 L*j (q0 < j <= q1) の合計 = L × (S(q1) - S(q0))、S(q) = q(q+1)/2
+		q1.Div(hi, tm.lcm)
+		q0.Div(below, tm.lcm)
+		t.Sub(triangular(q1), triangular(q0))
+		t.Mul(t, tm.lcm)
+		t.Mul(t, big.NewInt(tm.coef))
+		total.Add(total, t)
+	}
+	return total
+}
+
+// triangular は、q(q+1)/2 を返す
+func triangular(q *big.Int) *big.Int {
+	r := new(big.Int).Add(q, big.NewInt(1))
+	r.Mul(r, q)
+	return r.Rsh(r, 1)
+}
+
+// NthBig は、[lo, hi] で条件を満たす n 番目（1始まり）の整数を返す
+func (a *Arithmetic) NthBig(lo, hi, n *big.Int) (*big.Int, bool) {
+	if n.Sign() <= 0 || a.CountBig(lo, hi).Cmp(n) < 0 {
+		return nil, false
+	}
+	// count(lo..x) >= n となる最小の x を二分探索する
+	left, right := new(big.Int).Set(lo), new(big.Int).Set(hi)
+	mid := new(big.Int)
+	for left.Cmp(right) < 0 {
+		mid.Add(left, right)
+		mid.Rsh(mid, 1) // 負の数でも床関数になる
+		if a.CountBig(lo, mid).Cmp(n) >= 0 {
+			right.Set(mid)
+		} else {
+			left.Add(mid, big.NewInt(1))
+		}
+	}
+	return left, true
+}
+
+// PageBig は、[lo, hi] で条件を満たす整数のうち offset 件を飛ばした最大 limit 件を返す
+func (a *Arithmetic) PageBig(lo, hi, offset *big.Int, limit int) []*big.Int {
+	result := []*big.Int{}
+	n := new(big.Int).Add(offset, big.NewInt(1))
+	x, ok := a.NthBig(lo, hi, n)
+	for ok && len(result) < limit {
+		result = append(result, x)
+		x, ok = a.NthBig(new(big.Int).Add(x, big.NewInt(1)), hi, big.NewInt(1))
+	}
+	return result
+}
+
+// Count は、[lo, hi] で条件を満たす整数の個数を返す
+func (a *Arithmetic) Count(lo, hi int64) (int64, error) {
+	c := a.CountBig(big.NewInt(lo), big.NewInt(hi))
+	if !c.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return c.Int64(), nil
+}
+
+// Sum は、[lo, hi] で条件を満たす整数の合計を返す（int64 を超えうるので big.Int で返す）
+func (a *Arithmetic) Sum(lo, hi int64) *big.Int {
+	return a.SumBig(big.NewInt(lo), big.NewInt(hi))
+}
+
+// Nth は、[lo, hi] で条件を満たす n 番目（1始まり）の整数を返す
+func (a *Arithmetic) Nth(lo, hi, n int64) (int64, bool) {
+	x, ok := a.NthBig(big.NewInt(lo), big.NewInt(hi), big.NewInt(n))
+	if !ok {
+		return 0, false
+	}
+	return x.Int64(), true
+}
+
+// Page は、[lo, hi] で条件を満たす整数のうち offset 件を飛ばした最大 limit 件を返す
+func (a *Arithmetic) Page(lo, hi, offset int64, limit int) []int64 {
+	result := []int64{}
+	if limit <= 0 {
+		return result
+	}
+	first, ok := a.Nth(lo, hi, offset+1)
+	if !ok {
+		return result
+	}
+	for x := range a.All(first, hi) {
+		result = append(result, x)
+		if len(result) == limit {
+			break
+		}
+	}
+	return result
+}
+
+// All は、[lo, hi] で条件を満たす整数を昇順に返すイテレーター
+func (a *Arithmetic) All(lo, hi int64) iter.Seq[int64] {
+	return func(yield func(int64) bool) {
+		if lo > hi {
+			return
+		}
+		residues := a.residueTable()
+		if residues == nil {
+			// 周期が大きいときは n 番目の探索を繰り返す
+			a.allByNth(lo, hi, yield)
+			return
+		}
+		if len(residues) == 0 {
+			return
+		}
+
+		// lo からの距離を uint64 で扱うことで int64 の端でも溢れないようにする
+		period := a.period.Uint64()
+		span := uint64(hi) - uint64(lo)
+		phase := uint64(((lo % int64(period)) + int64(period)) % int64(period))
+		offsets := make([]uint64, len(residues))
+		for i, r := range residues {
+			offsets[i] = (r + period - phase) % period
+		}
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+		for start := uint64(0); ; start += period {
+			for _, d := range offsets {
+				if d > span-start {
+					return
+				}
+				if !yield(int64(uint64(lo) + start + d)) {
+					return
+				}
+			}
+			if span-start < period {
+				return
+			}
+		}
+	}
+}
+
+// allByNth は、n 番目の探索を繰り返して条件を満たす整数を列挙する
+func (a *Arithmetic) allByNth(lo, hi int64, yield func(int64) bool) {
+	for {
+		x, ok := a.Nth(lo, hi, 1)
+		if !ok || !yield(x) || x == math.MaxInt64 {
+			return
+		}
+		lo = x + 1
+	}
+}
+
+// residueTable は、周期内で条件を満たす剰余の表を返す
+func (a *Arithmetic) residueTable() []uint64 {
+	a.tableOnce.Do(func() {
+		if !a.period.IsInt64() || a.period.Int64() > maxResidueTable {
+			return
+		}
+		period := a.period.Int64()
+		a.residues = []uint64{}
+		for r := int64(0); r < period; r++ {
+			if a.pred.Match(r) {
+				a.residues = append(a.residues, uint64(r))
+			}
+		}
+	})
+	return a.residues
+}
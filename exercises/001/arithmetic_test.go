@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"slices"
+	"testing"
+)
+
+// bruteForce は、範囲を1つずつ調べて件数・合計・一覧を求める
+func bruteForce(p *Predicate, lo, hi int64) (int64, int64, []int64) {
+	var count, sum int64
+	matches := []int64{}
+	for i := lo; i <= hi; i++ {
+		if p.Match(i) {
+			count++
+			sum += i
+			matches = append(matches, i)
+		}
+	}
+	return count, sum, matches
+}
+
+func TestArithmeticMatchesBruteForce(t *testing.T) {
+	exprs := []string{
+		"div(7) && !div(5)",
+		"div(2) || div(3)",
+		"!(div(4) || div(6)) && div(3)",
+		"div(6) && div(4)",
+		"div(3) && !div(3)",
+		"true",
+		"false",
+		"(div(2) || div(5)) && !(div(10) && !div(20))",
+	}
+	ranges := [][2]int64{{1, 100}, {2000, 3200}, {-150, 75}, {-99, -3}, {0, 0}, {10, 9}}
+
+	for _, expr := range exprs {
+		p := MustCompile(expr)
+		a, err := NewArithmetic(p)
+		if err != nil {
+			t.Fatalf("NewArithmetic(%q) failed: %v", expr, err)
+		}
+		for _, r := range ranges {
+			lo, hi := r[0], r[1]
+			wantCount, wantSum, wantList := bruteForce(p, lo, hi)
+
+			if got, err := a.Count(lo, hi); err != nil || got != wantCount {
+				t.Errorf("%q Count(%d, %d) = %d, %v; want %d", expr, lo, hi, got, err, wantCount)
+			}
+			if got := a.Sum(lo, hi); got.Cmp(big.NewInt(wantSum)) != 0 {
+				t.Errorf("%q Sum(%d, %d) = %v, want %d", expr, lo, hi, got, wantSum)
+			}
+			if got := slices.Collect(a.All(lo, hi)); !slices.Equal(got, wantList) {
+				t.Errorf("%q All(%d, %d) = %v, want %v", expr, lo, hi, got, wantList)
+			}
+			for n := int64(1); n <= int64(len(wantList)); n += 3 {
+				if got, ok := a.Nth(lo, hi, n); !ok || got != wantList[n-1] {
+					t.Errorf("%q Nth(%d, %d, %d) = %d, %v; want %d", expr, lo, hi, n, got, ok, wantList[n-1])
+				}
+			}
+			if _, ok := a.Nth(lo, hi, wantCount+1); ok {
+				t.Errorf("%q Nth(%d, %d, %d) should not exist", expr, lo, hi, wantCount+1)
+			}
+		}
+	}
+}
+
+func TestArithmeticHugeRange(t *testing.T) {
+	a, err := NewArithmetic(MustCompile("div(7) && !div(5)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1..10^15 の件数は floor(N/7) - floor(N/35)
+	const n = int64(1_000_000_000_000_000)
+	got, err := a.Count(1, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := n/7 - n/35; got != want {
+		t.Errorf("Count(1, 10^15) = %d, want %d", got, want)
+	}
+
+	// 合計は 7×S(N/7) - 35×S(N/35)
+	s := func(m int64) *big.Int {
+		q := big.NewInt(n / m)
+		r := new(big.Int).Mul(q, new(big.Int).Add(q, big.NewInt(1)))
+		r.Rsh(r, 1)
+		return r.Mul(r, big.NewInt(m))
+	}
+	want := new(big.Int).Sub(s(7), s(35))
+	if got := a.Sum(1, n); got.Cmp(want) != 0 {
+		t.Errorf("Sum(1, 10^15) = %v, want %v", got, want)
+	}
+
+	// 末尾付近のページ
+	last, ok := a.Nth(1, n, got)
+	if !ok || last != 999_999_999_999_994 {
+		t.Errorf("last match = %d, %v; want 999999999999994", last, ok)
+	}
+	page := a.Page(1, n, got-3, 10)
+	if !slices.Equal(page, []int64{999_999_999_999_973, 999_999_999_999_987, 999_999_999_999_994}) {
+		t.Errorf("Page near end = %v", page)
+	}
+}
+
+func TestArithmeticInt64Bounds(t *testing.T) {
+	a, err := NewArithmetic(MustCompile("!div(2)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := slices.Collect(a.All(math.MaxInt64-4, math.MaxInt64))
+	want := []int64{math.MaxInt64 - 4, math.MaxInt64 - 2, math.MaxInt64}
+	if !slices.Equal(got, want) {
+		t.Errorf("All near MaxInt64 = %v, want %v", got, want)
+	}
+
+	// 全 int64 の個数は int64 に収まらない
+	all, _ := NewArithmetic(MustCompile("true"))
+	if _, err := all.Count(math.MinInt64, math.MaxInt64); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Count over full int64 range error = %v, want ErrOverflow", err)
+	}
+}
+
+func TestArithmeticBig(t *testing.T) {
+	a, err := NewArithmetic(MustCompile("div(1000000007) && div(998244353)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lo := big.NewInt(1)
+	hi, _ := new(big.Int).SetString("1000000000000000000000000000000", 10)
+
+	period := new(big.Int).Mul(big.NewInt(1000000007), big.NewInt(998244353))
+	if a.Period().Cmp(period) != 0 {
+		t.Errorf("Period() = %v, want %v", a.Period(), period)
+	}
+	wantCount := new(big.Int).Div(hi, period)
+	if got := a.CountBig(lo, hi); got.Cmp(wantCount) != 0 {
+		t.Errorf("CountBig = %v, want %v", got, wantCount)
+	}
+
+	third, ok := a.NthBig(lo, hi, big.NewInt(3))
+	if want := new(big.Int).Mul(period, big.NewInt(3)); !ok || third.Cmp(want) != 0 {
+		t.Errorf("NthBig(3) = %v, %v; want %v", third, ok, want)
+	}
+	page := a.PageBig(lo, hi, big.NewInt(1), 2)
+	if len(page) != 2 || page[0].Cmp(new(big.Int).Mul(period, big.NewInt(2))) != 0 {
+		t.Errorf("PageBig = %v", page)
+	}
+}
+
+func TestNewArithmeticErrors(t *testing.T) {
+	if _, err := NewArithmetic(MustCompile("div(7) || digitsum(12)")); !errors.Is(err, ErrNotArithmetic) {
+		t.Errorf("expected ErrNotArithmetic, got %v", err)
+	}
+	expr := "div(2)"
+	for d := 3; d <= 2+maxArithmeticConditions; d++ {
+		expr += " || div(" + big.NewInt(int64(d)).String() + ")"
+	}
+	if _, err := NewArithmetic(MustCompile(expr)); !errors.Is(err, ErrTooManyConditions) {
+		t.Errorf("expected ErrTooManyConditions, got %v", err)
+	}
+}
+
+func BenchmarkArithmeticCount(b *testing.B) {
+	a, _ := NewArithmetic(MustCompile("div(7) && !div(5)"))
+	for b.Loop() {
+		a.Count(1, 1_000_000_000_000_000)
+	}
+}
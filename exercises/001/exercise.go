@@ -9,35 +9,102 @@ Exercise:
 */
 
 import (
+	// コマンドライン引数を扱う
+	"flag"
 	// 文字を表示する
 	"fmt"
-	// 文字列を数値に変換する
-	"strconv"
+	// エラーを表示して終了する
+	"log"
+	// 結果を組み立てる
+	"strings"
 )
 
 func main() {
+	// 条件式・出力形式・範囲をコマンドライン引数で指定できるようにする
+	expr := flag.String("expr", DefaultExpr, "predicate expression, e.g. \"div(7) && !div(5)\"")
+	format := flag.String("format", "comma", "output format: comma, newline, json or csv")
+	from := flag.Int("from", 2000, "lowest number")
+	to := flag.Int("to", 3200, "highest number")
+	flag.Parse()
+
+	pred, err := Compile(*expr)
+	if err != nil {
+		// 構文エラーの場合は位置を示して終了する
+		if se, ok := err.(*SyntaxError); ok {
+			log.Fatalf("%v\n%s", se, se.Caret())
+		}
+		log.Fatal(err)
+	}
+	f, err := ParseFormat(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// "Exercise 001"を表示する
 	fmt.Println("Exercise 001")
 	// Ex001を呼び出す
-	res := Ex001(2000, 3200)
+	res := Ex001(*from, *to, WithPredicate(pred), WithFormat(f))
 	// 結果を表示する
 	fmt.Println(res)
 }
 
-func Ex001(lowest_number, highest_number int) string {
-	// 結果を保持する
-	var result string
-	for i := lowest_number; i <= highest_number; i++ {
-		// 5では割り切れない, 7で割り切れる
-		if i%7 == 0 && i%5 != 0 {
-			// 結果が空でないとき、カンマを追加する
-			if result != "" {
-				result += ","
-			}
-			// 結果をカンマ区切りで連結する
-			result += strconv.Itoa(i)
-		}
+// DefaultExpr は、Ex001 の既定の条件（7で割り切れ、5では割り切れない）
+const DefaultExpr = "div(7) && !div(5)"
+
+// Format は、Ex001 の出力形式
+type Format int
+
+const (
+	FormatComma   Format = iota // カンマ区切りで1行
+	FormatNewline               // 1行に1つ
+	FormatJSON                  // JSON配列
+	FormatCSV                   // ヘッダー付きCSV
+)
+
+// ParseFormat は、名前から Format を返す
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "comma":
+		return FormatComma, nil
+	case "newline":
+		return FormatNewline, nil
+	case "json":
+		return FormatJSON, nil
+	case "csv":
+		return FormatCSV, nil
+	}
+	return 0, fmt.Errorf("unknown format %q", name)
+}
+
+// Option は、Ex001 の動作を変更する
+type Option func(*options)
+
+type options struct {
+	pred   *Predicate
+	format Format
+}
+
+// WithPredicate は、抽出条件を指定する
+func WithPredicate(p *Predicate) Option {
+	return func(o *options) { o.pred = p }
+}
+
+// WithFormat は、出力形式を指定する
+func WithFormat(f Format) Option {
+	return func(o *options) { o.format = f }
+}
+
+var defaultPredicate = MustCompile(DefaultExpr)
+
+func Ex001(lowest_number, highest_number int, opts ...Option) string {
+	o := options{pred: defaultPredicate, format: FormatComma}
+	for _, opt := range opts {
+		opt(&o)
 	}
+
+	// 条件に当てはまる数字を指定された形式で書き出す
+	var sb strings.Builder
+	WriteMatches(&sb, int64(lowest_number), int64(highest_number), o.pred, o.format)
 	// 結果を返す
-	return result
+	return sb.String()
 }
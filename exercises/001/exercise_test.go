@@ -18,3 +18,36 @@ func TestExercise001(t *testing.T) {
 		t.Errorf("Expected %s but got %s", want, got) // t.Errorf()は、テストが失敗したときに表示するメッセージを返す
 	}
 }
+
+func TestExercise001Formats(t *testing.T) {
+	pred := MustCompile("div(7) && !div(5)")
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{FormatComma, "2002,2009,2016"},
+		{FormatNewline, "2002\n2009\n2016"},
+		{FormatJSON, "[2002,2009,2016]"},
+		{FormatCSV, "number\n2002\n2009\n2016\n"},
+	}
+
+	for _, tt := range tests {
+		got := Ex001(2000, 2020, WithPredicate(pred), WithFormat(tt.format))
+		if got != tt.want {
+			t.Errorf("Ex001 with format %d = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+
+	// 該当なしでもJSONは空配列を返す
+	if got := Ex001(1, 6, WithFormat(FormatJSON)); got != "[]" {
+		t.Errorf("Expected [] but got %s", got)
+	}
+}
+
+func TestExercise001Predicate(t *testing.T) {
+	got := Ex001(2000, 2060, WithPredicate(MustCompile("div(7) && !div(5) || digitsum(12)")))
+	want := "2002,2009,2016,2019,2023,2028,2037,2044,2046,2051,2055,2058"
+	if got != want {
+		t.Errorf("Expected %s but got %s", want, got)
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+/*
+述語式言語
+
+Ex001 の抽出条件を文字列で記述するための小さな論理式言語です。
+
+	expr    := or
+	or      := and ( "||" and )*
+	and     := unary ( "&&" unary )*
+	unary   := "!" unary | primary
+	primary := "(" expr ")" | "true" | "false" | call
+	call    := ident "(" int ( "," int )* ")"
+
+利用できる関数:
+- div(n)      : n で割り切れる
+- digitsum(n) : 各桁の和が n に等しい
+
+例: div(7) && !div(5) || digitsum(12)
+*/
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SyntaxError は、述語式の構文エラーを表す
+type SyntaxError struct {
+	Expr string // 解析対象の式
+	Pos  int    // エラー位置（0始まりのバイトオフセット）
+	Msg  string // エラー内容
+}
+
+// Error は、エラー位置を含むメッセージを返す
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at column %d in %q: %s", e.Pos+1, e.Expr, e.Msg)
+}
+
+// Caret は、式とエラー位置を指す ^ を2行で返す
+func (e *SyntaxError) Caret() string {
+	return e.Expr + "\n" + strings.Repeat(" ", e.Pos) + "^"
+}
+
+// トークンの種類
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokLParen
+	tokRParen
+	tokComma
+	tokAnd
+	tokOr
+	tokNot
+)
+
+// token は、字句解析の結果
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// describe は、エラーメッセージ用にトークンを表現する
+func (t token) describe() string {
+	if t.kind == tokEOF {
+		return "end of input"
+	}
+	return strconv.Quote(t.text)
+}
+
+// tokenize は、式をトークン列に分割する
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case c == '!':
+			tokens = append(tokens, token{tokNot, "!", i})
+			i++
+		case c == '&' || c == '|':
+			// && と || は2文字で1トークン
+			if i+1 >= len(src) || src[i+1] != c {
+				return nil, &SyntaxError{Expr: src, Pos: i, Msg: fmt.Sprintf("unexpected %q, did you mean %q?", c, string([]byte{c, c}))}
+			}
+			kind := tokAnd
+			if c == '|' {
+				kind = tokOr
+			}
+			tokens = append(tokens, token{kind, src[i : i+2], i})
+			i += 2
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+				i++
+			}
+			tokens = append(tokens, token{tokInt, src[start:i], start})
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			start := i
+			for i < len(src) && (src[i] == '_' || (src[i] >= 'a' && src[i] <= 'z') || (src[i] >= 'A' && src[i] <= 'Z') || (src[i] >= '0' && src[i] <= '9')) {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, src[start:i], start})
+		default:
+			return nil, &SyntaxError{Expr: src, Pos: i, Msg: fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	tokens = append(tokens, token{tokEOF, "", len(src)})
+	return tokens, nil
+}
+
+// node は、構文木のノード
+type node interface {
+	eval(n int64) bool
+	String() string
+}
+
+type orNode struct{ left, right node }
+
+func (o *orNode) eval(n int64) bool { return o.left.eval(n) || o.right.eval(n) }
+func (o *orNode) String() string    { return "(" + o.left.String() + " || " + o.right.String() + ")" }
+
+type andNode struct{ left, right node }
+
+func (a *andNode) eval(n int64) bool { return a.left.eval(n) && a.right.eval(n) }
+func (a *andNode) String() string    { return "(" + a.left.String() + " && " + a.right.String() + ")" }
+
+type notNode struct{ operand node }
+
+func (x *notNode) eval(n int64) bool { return !x.operand.eval(n) }
+func (x *notNode) String() string    { return "!" + x.operand.String() }
+
+type constNode struct{ value bool }
+
+func (c *constNode) eval(int64) bool { return c.value }
+func (c *constNode) String() string  { return strconv.FormatBool(c.value) }
+
+type callNode struct {
+	name string
+	args []int64
+	fn   func(int64) bool
+}
+
+func (c *callNode) eval(n int64) bool { return c.fn(n) }
+func (c *callNode) String() string {
+	args := make([]string, len(c.args))
+	for i, a := range c.args {
+		args[i] = strconv.FormatInt(a, 10)
+	}
+	return c.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// builtin は、述語式から呼び出せる関数の定義
+type builtin struct {
+	arity int
+	build func(args []int64) (func(int64) bool, error)
+}
+
+var builtins = map[string]builtin{
+	"div": {
+		arity: 1,
+		build: func(args []int64) (func(int64) bool, error) {
+			d := args[0]
+			if d == 0 {
+				return nil, fmt.Errorf("div: divisor must be positive")
+			}
+			return func(n int64) bool { return n%d == 0 }, nil
+		},
+	},
+	"digitsum": {
+		arity: 1,
+		build: func(args []int64) (func(int64) bool, error) {
+			want := args[0]
+			return func(n int64) bool { return digitSum(n) == want }, nil
+		},
+	},
+}
+
+// digitSum は、n の各桁（10進数）の和を返す
+func digitSum(n int64) int64 {
+	var sum int64
+	for n != 0 {
+		d := n % 10
+		if d < 0 {
+			d = -d
+		}
+		sum += d
+		n /= 10
+	}
+	return sum
+}
+
+// parser は、トークン列から構文木を組み立てる再帰下降パーサー
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &SyntaxError{Expr: p.src, Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) expect(kind tokenKind, want string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.errorf(t, "expected %q but found %s", want, t.describe())
+	}
+	return t, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &constNode{true}, nil
+		case "false":
+			return &constNode{false}, nil
+		}
+		return p.parseCall(t)
+	default:
+		return nil, p.errorf(t, "expected condition but found %s", t.describe())
+	}
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	b, ok := builtins[name.text]
+	if !ok {
+		return nil, p.errorf(name, "unknown function %q", name.text)
+	}
+	if _, err := p.expect(tokLParen, "("); err != nil {
+		return nil, err
+	}
+
+	// 引数（整数）をカンマ区切りで読み取る
+	var args []int64
+	for {
+		t := p.next()
+		if t.kind != tokInt {
+			return nil, p.errorf(t, "expected integer argument but found %s", t.describe())
+		}
+		v, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, p.errorf(t, "integer %s out of range", t.text)
+		}
+		args = append(args, v)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(tokRParen, ")"); err != nil {
+		return nil, err
+	}
+
+	if len(args) != b.arity {
+		return nil, p.errorf(name, "%s expects %d argument(s) but got %d", name.text, b.arity, len(args))
+	}
+	fn, err := b.build(args)
+	if err != nil {
+		return nil, p.errorf(name, "%v", err)
+	}
+	return &callNode{name: name.text, args: args, fn: fn}, nil
+}
+
+// Predicate は、コンパイル済みの述語式
+type Predicate struct {
+	src  string
+	root node
+}
+
+// Compile は、述語式を解析して Predicate を返す
+func Compile(src string) (*Predicate, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, p.errorf(p.peek(), "empty expression")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	// 式の後ろに余分なトークンが残っていないか確認する
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %s after expression", t.describe())
+	}
+	return &Predicate{src: src, root: root}, nil
+}
+
+// MustCompile は、Compile と同じだがエラー時に panic する
+func MustCompile(src string) *Predicate {
+	p, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Match は、n が条件を満たすかどうかを返す
+func (p *Predicate) Match(n int64) bool {
+	return p.root.eval(n)
+}
+
+// Source は、コンパイル前の式を返す
+func (p *Predicate) Source() string {
+	return p.src
+}
+
+// String は、括弧を補った正規化済みの式を返す
+func (p *Predicate) String() string {
+	return p.root.String()
+}
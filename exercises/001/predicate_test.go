@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPredicateMatch(t *testing.T) {
+	tests := []struct {
+		expr string
+		n    int64
+		want bool
+	}{
+		{"div(7)", 14, true},
+		{"div(7)", 15, false},
+		{"div(7) && !div(5)", 2002, true},
+		{"div(7) && !div(5)", 2030, false},
+		{"digitsum(12)", 2055, true},
+		{"digitsum(12)", 2056, false},
+		// && は || より優先される
+		{"div(7) && !div(5) || digitsum(12)", 2055, true},
+		{"div(7) && (!div(5) || digitsum(12))", 2055, false},
+		{"!!div(3)", 9, true},
+		{"true", 1, true},
+		{"false || div(2)", 4, true},
+	}
+
+	for _, tt := range tests {
+		p, err := Compile(tt.expr)
+		if err != nil {
+			t.Fatalf("Compile(%q) failed: %v", tt.expr, err)
+		}
+		if got := p.Match(tt.n); got != tt.want {
+			t.Errorf("Compile(%q).Match(%d) = %v, want %v", tt.expr, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestPredicateString(t *testing.T) {
+	p := MustCompile("div(7)&&!div(5)||digitsum(12)")
+	want := "((div(7) && !div(5)) || digitsum(12))"
+	if got := p.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestCompileSyntaxError(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantPos int
+	}{
+		{"", 0},
+		{"div(7", 5},
+		{"div(7) &", 7},
+		{"div(7) div(5)", 7},
+		{"mod(7)", 0},
+		{"div()", 4},
+		{"div(7, 5)", 0},
+		{"div(0)", 0},
+		{"div(7) && ", 10},
+		{"div(7) # 1", 7},
+		{"(div(7)", 7},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(tt.expr)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("Compile(%q) error = %v, want *SyntaxError", tt.expr, err)
+			continue
+		}
+		if se.Pos != tt.wantPos {
+			t.Errorf("Compile(%q) error position = %d, want %d (%v)", tt.expr, se.Pos, tt.wantPos, se)
+		}
+	}
+}
+
+func TestSyntaxErrorCaret(t *testing.T) {
+	_, err := Compile("div(7")
+	se := err.(*SyntaxError)
+	want := "div(7\n     ^"
+	if got := se.Caret(); got != want {
+		t.Errorf("Caret() = %q, want %q", got, want)
+	}
+}
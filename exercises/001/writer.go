@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+)
+
+// MatchWriter は、条件を満たした数字を指定形式で io.Writer に逐次書き出す
+type MatchWriter struct {
+	w      *bufio.Writer
+	format Format
+	count  int
+	buf    []byte
+	closed bool
+}
+
+// NewMatchWriter は、MatchWriter を作成する
+func NewMatchWriter(w io.Writer, format Format) *MatchWriter {
+	return &MatchWriter{w: bufio.NewWriter(w), format: format}
+}
+
+// WriteInt は、数字を1つ書き出す
+func (mw *MatchWriter) WriteInt(n int64) error {
+	if mw.closed {
+		return errors.New("write to closed MatchWriter")
+	}
+	mw.buf = mw.buf[:0]
+	if mw.count == 0 {
+		mw.buf = append(mw.buf, mw.header()...)
+	} else {
+		mw.buf = append(mw.buf, mw.separator()...)
+	}
+	mw.buf = strconv.AppendInt(mw.buf, n, 10)
+	if mw.format == FormatCSV {
+		mw.buf = append(mw.buf, '\n')
+	}
+	mw.count++
+	_, err := mw.w.Write(mw.buf)
+	return err
+}
+
+// Count は、書き出した数字の個数を返す
+func (mw *MatchWriter) Count() int {
+	return mw.count
+}
+
+// Close は、形式の終端（JSON の ] など）を書き出してバッファをフラッシュする
+// 下位の io.Writer は閉じない
+func (mw *MatchWriter) Close() error {
+	if mw.closed {
+		return nil
+	}
+	mw.closed = true
+	if mw.count == 0 {
+		mw.w.WriteString(mw.header())
+	}
+	if mw.format == FormatJSON {
+		mw.w.WriteString("]")
+	}
+	return mw.w.Flush()
+}
+
+func (mw *MatchWriter) header() string {
+	switch mw.format {
+	case FormatJSON:
+		return "["
+	case FormatCSV:
+		return "number\n"
+	}
+	return ""
+}
+
+func (mw *MatchWriter) separator() string {
+	switch mw.format {
+	case FormatNewline:
+		return "\n"
+	case FormatCSV:
+		return ""
+	}
+	return ","
+}
+
+// WriteMatches は、[lo, hi] で条件を満たす数字を w に書き出す
+// div だけからなる述語は算術エンジンで次の値へ直接進み、それ以外は1つずつ調べる
+func WriteMatches(w io.Writer, lo, hi int64, pred *Predicate, format Format) error {
+	mw := NewMatchWriter(w, format)
+	if a, err := NewArithmetic(pred); err == nil {
+		for n := range a.All(lo, hi) {
+			if err := mw.WriteInt(n); err != nil {
+				return err
+			}
+		}
+		return mw.Close()
+	}
+
+	for i := lo; i <= hi; i++ {
+		if pred.Match(i) {
+			if err := mw.WriteInt(i); err != nil {
+				return err
+			}
+		}
+		// hi が int64 の最大値のときに i++ で溢れないようにする
+		if i == math.MaxInt64 {
+			break
+		}
+	}
+	return mw.Close()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchWriter(t *testing.T) {
+	tests := []struct {
+		format Format
+		nums   []int64
+		want   string
+	}{
+		{FormatComma, []int64{1, 2, 3}, "1,2,3"},
+		{FormatComma, nil, ""},
+		{FormatNewline, []int64{-1, 2}, "-1\n2"},
+		{FormatJSON, []int64{1, 2}, "[1,2]"},
+		{FormatJSON, nil, "[]"},
+		{FormatCSV, []int64{7}, "number\n7\n"},
+		{FormatCSV, nil, "number\n"},
+	}
+
+	for _, tt := range tests {
+		var sb strings.Builder
+		mw := NewMatchWriter(&sb, tt.format)
+		for _, n := range tt.nums {
+			if err := mw.WriteInt(n); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := mw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if sb.String() != tt.want {
+			t.Errorf("format %d with %v = %q, want %q", tt.format, tt.nums, sb.String(), tt.want)
+		}
+		if mw.Count() != len(tt.nums) {
+			t.Errorf("Count() = %d, want %d", mw.Count(), len(tt.nums))
+		}
+		if err := mw.WriteInt(1); err == nil {
+			t.Error("expected error writing to closed MatchWriter")
+		}
+	}
+}
+
+func TestWriteMatchesFallback(t *testing.T) {
+	// digitsum を含む述語は1つずつ調べる
+	var sb strings.Builder
+	err := WriteMatches(&sb, 1, 40, MustCompile("digitsum(5)"), FormatComma)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "5,14,23,32"; sb.String() != want {
+		t.Errorf("WriteMatches = %q, want %q", sb.String(), want)
+	}
+}
+
+func BenchmarkEx001(b *testing.B) {
+	for b.Loop() {
+		Ex001(1, 1_000_000)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+)
+
+// ErrNegative は、引数が負の数のときのエラー
+var ErrNegative = errors.New("arguments must be non-negative")
+
+// ErrNotPrime は、法が素数でないときのエラー
+var ErrNotPrime = errors.New("modulus must be prime")
+
+// NaiveFactorial は、1 から n まで順に掛けて n! を求める（比較用の素朴な実装）
+func NaiveFactorial(n int) *big.Int {
+	result := big.NewInt(1)
+	for i := 2; i <= n; i++ {
+		result.Mul(result, big.NewInt(int64(i)))
+	}
+	return result
+}
+
+// FastFactorial は、Prime Swing 法で n! を求める
+//
+//	n! = (⌊n/2⌋!)² × swing(n)
+//
+// swing(n) = n! / (⌊n/2⌋!)² は素因数分解から直接求め、積は二分割で計算する
+func FastFactorial(n int) *big.Int {
+	if n < 2 {
+		return big.NewInt(1)
+	}
+	primes := primesUpTo(n)
+	return swingFactorial(n, primes)
+}
+
+func swingFactorial(n int, primes []int) *big.Int {
+	if n < 2 {
+		return big.NewInt(1)
+	}
+	half := swingFactorial(n/2, primes)
+	result := new(big.Int).Mul(half, half)
+	return result.Mul(result, swing(n, primes))
+}
+
+// swing は、n の swing 数 n! / (⌊n/2⌋!)² を返す
+func swing(n int, primes []int) *big.Int {
+	var factors []uint64
+	for _, p := range primes {
+		if p > n {
+			break
+		}
+		// 素数 p の指数は、n を p で割り続けたときの商の奇数の個数
+		power := uint64(1)
+		for q := n / p; q > 0; q /= p {
+			if q&1 == 1 {
+				power *= uint64(p)
+			}
+		}
+		if power > 1 {
+			factors = append(factors, power)
+		}
+	}
+	return product(factors)
+}
+
+// product は、数の積を二分割で計算する（大きさの近い数同士を掛けるので速い）
+func product(factors []uint64) *big.Int {
+	switch len(factors) {
+	case 0:
+		return big.NewInt(1)
+	case 1:
+		return new(big.Int).SetUint64(factors[0])
+	}
+	mid := len(factors) / 2
+	left := product(factors[:mid])
+	return left.Mul(left, product(factors[mid:]))
+}
+
+// primesUpTo は、エラトステネスの篩で n 以下の素数を返す
+func primesUpTo(n int) []int {
+	composite := make([]bool, n+1)
+	var primes []int
+	for i := 2; i <= n; i++ {
+		if composite[i] {
+			continue
+		}
+		primes = append(primes, i)
+		for j := i * i; j <= n; j += i {
+			composite[j] = true
+		}
+	}
+	return primes
+}
+
+// Binomial は、二項係数 nCr を返す
+func Binomial(n, r int) (*big.Int, error) {
+	if n < 0 || r < 0 {
+		return nil, ErrNegative
+	}
+	if r > n {
+		return big.NewInt(0), nil
+	}
+	// nCr = nCn-r なので小さい方を使う
+	if r > n-r {
+		r = n - r
+	}
+	// n×(n-1)×…×(n-r+1) / r!
+	// r! は共有キャッシュに載せず FastFactorial で求める（キャッシュは 0!..r! を全て保持し続けるため）
+	result := new(big.Int).MulRange(int64(n-r+1), int64(n))
+	return result.Quo(result, FastFactorial(r)), nil
+}
+
+// Permutations は、順列 nPr を返す
+func Permutations(n, r int) (*big.Int, error) {
+	if n < 0 || r < 0 {
+		return nil, ErrNegative
+	}
+	if r > n {
+		return big.NewInt(0), nil
+	}
+	return new(big.Int).MulRange(int64(n-r+1), int64(n)), nil
+}
+
+// Multinomial は、多項係数 (k1+k2+…)! / (k1!×k2!×…) を返す
+func Multinomial(ks ...int) (*big.Int, error) {
+	result := big.NewInt(1)
+	total := 0
+	for _, k := range ks {
+		if k < 0 {
+			return nil, ErrNegative
+		}
+		// 二項係数の積として順に計算する
+		total += k
+		b, _ := Binomial(total, k)
+		result.Mul(result, b)
+	}
+	return result, nil
+}
+
+// Catalan は、n 番目のカタラン数 C(2n, n) / (n+1) を返す
+func Catalan(n int) (*big.Int, error) {
+	if n < 0 {
+		return nil, ErrNegative
+	}
+	result, _ := Binomial(2*n, n)
+	return result.Quo(result, big.NewInt(int64(n+1))), nil
+}
+
+// FactorialMod は、素数 p について n! mod p を返す
+// n が p に近いときはウィルソンの定理 (p-1)! ≡ -1 (mod p) を使って掛け算の回数を減らす
+func FactorialMod(n, p int64) (int64, error) {
+	if n < 0 || p < 0 {
+		return 0, ErrNegative
+	}
+	if !big.NewInt(p).ProbablyPrime(20) {
+		return 0, ErrNotPrime
+	}
+	if n >= p {
+		return 0, nil
+	}
+
+	mod := big.NewInt(p)
+	acc := big.NewInt(1)
+	if n < p/2 {
+		// 1×2×…×n
+		for i := int64(2); i <= n; i++ {
+			acc.Mul(acc, big.NewInt(i)).Mod(acc, mod)
+		}
+		return acc.Int64(), nil
+	}
+
+	// n! ≡ -1 / ((n+1)×…×(p-1)) (mod p)
+	for i := n + 1; i < p; i++ {
+		acc.Mul(acc, big.NewInt(i)).Mod(acc, mod)
+	}
+	acc.ModInverse(acc, mod)
+	acc.Neg(acc).Mod(acc, mod)
+	return acc.Int64(), nil
+}
+
+// BinomialMod は、リュカの定理を使って素数 p について nCr mod p を返す
+func BinomialMod(n, r, p int64) (int64, error) {
+	if n < 0 || r < 0 || p < 0 {
+		return 0, ErrNegative
+	}
+	if !big.NewInt(p).ProbablyPrime(20) {
+		return 0, ErrNotPrime
+	}
+
+	// n と r を p 進数で1桁ずつ見て、各桁の二項係数を掛け合わせる
+	mod := big.NewInt(p)
+	result := big.NewInt(1)
+	for n > 0 || r > 0 {
+		ni, ri := n%p, r%p
+		if ri > ni {
+			return 0, nil
+		}
+		num, _ := FactorialMod(ni, p)
+		den1, _ := FactorialMod(ri, p)
+		den2, _ := FactorialMod(ni-ri, p)
+		den := new(big.Int).Mul(big.NewInt(den1), big.NewInt(den2))
+		den.ModInverse(den.Mod(den, mod), mod)
+		result.Mul(result, big.NewInt(num)).Mul(result, den).Mod(result, mod)
+		n, r = n/p, r/p
+	}
+	return result.Int64(), nil
+}
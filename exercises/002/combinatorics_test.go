@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestFastFactorial(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 10, 20, 21, 97, 128, 1000, 5001} {
+		want := NaiveFactorial(n)
+		if got := FastFactorial(n); got.Cmp(want) != 0 {
+			t.Errorf("FastFactorial(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestBinomialAndPermutations(t *testing.T) {
+	for n := 0; n <= 40; n++ {
+		for r := 0; r <= n+1; r++ {
+			got, err := Binomial(n, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := new(big.Int).Binomial(int64(n), int64(r)); r <= n && got.Cmp(want) != 0 {
+				t.Errorf("Binomial(%d, %d) = %v, want %v", n, r, got, want)
+			}
+
+			perm, err := Permutations(n, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// nPr = nCr × r!
+			want := new(big.Int).Mul(got, NaiveFactorial(r))
+			if perm.Cmp(want) != 0 {
+				t.Errorf("Permutations(%d, %d) = %v, want %v", n, r, perm, want)
+			}
+		}
+	}
+
+	if got, _ := Binomial(3, 5); got.Sign() != 0 {
+		t.Errorf("Binomial(3, 5) = %v, want 0", got)
+	}
+	if _, err := Binomial(-1, 0); !errors.Is(err, ErrNegative) {
+		t.Errorf("Binomial(-1, 0) error = %v, want ErrNegative", err)
+	}
+
+	// 大きな r でも共有キャッシュを伸ばさない
+	defaultCache.mu.RLock()
+	before := len(defaultCache.values)
+	defaultCache.mu.RUnlock()
+	got, _ := Binomial(6000, 3000)
+	if want := new(big.Int).Binomial(6000, 3000); got.Cmp(want) != 0 {
+		t.Error("Binomial(6000, 3000) differs from big.Int.Binomial")
+	}
+	defaultCache.mu.RLock()
+	after := len(defaultCache.values)
+	defaultCache.mu.RUnlock()
+	if after != before {
+		t.Errorf("Binomial grew the factorial cache from %d to %d entries", before, after)
+	}
+}
+
+func TestMultinomial(t *testing.T) {
+	tests := []struct {
+		ks   []int
+		want int64
+	}{
+		{[]int{2, 1, 1}, 12},
+		{[]int{3, 3}, 20},
+		{[]int{1, 1, 1, 1}, 24},
+		{[]int{}, 1},
+		{[]int{0, 5}, 1},
+	}
+	for _, tt := range tests {
+		got, err := Multinomial(tt.ks...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Int64() != tt.want {
+			t.Errorf("Multinomial(%v) = %v, want %d", tt.ks, got, tt.want)
+		}
+	}
+}
+
+func TestCatalan(t *testing.T) {
+	want := []int64{1, 1, 2, 5, 14, 42, 132, 429, 1430, 4862}
+	for n, w := range want {
+		got, err := Catalan(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Int64() != w {
+			t.Errorf("Catalan(%d) = %v, want %d", n, got, w)
+		}
+	}
+}
+
+func TestFactorialMod(t *testing.T) {
+	for _, p := range []int64{2, 3, 7, 13, 101} {
+		for n := int64(0); n <= p+1; n++ {
+			want := new(big.Int).Mod(NaiveFactorial(int(n)), big.NewInt(p)).Int64()
+			got, err := FactorialMod(n, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("FactorialMod(%d, %d) = %d, want %d", n, p, got, want)
+			}
+		}
+	}
+
+	// ウィルソンの定理: (p-1)! ≡ p-1 (mod p)
+	if got, _ := FactorialMod(1_000_002, 1_000_003); got != 1_000_002 {
+		t.Errorf("FactorialMod(p-1, p) = %d, want p-1", got)
+	}
+	if _, err := FactorialMod(5, 12); !errors.Is(err, ErrNotPrime) {
+		t.Errorf("FactorialMod(5, 12) error = %v, want ErrNotPrime", err)
+	}
+}
+
+func TestBinomialMod(t *testing.T) {
+	for _, p := range []int64{2, 3, 5, 7} {
+		for n := int64(0); n <= 60; n++ {
+			for r := int64(0); r <= n; r += 3 {
+				want := new(big.Int).Binomial(n, r)
+				want.Mod(want, big.NewInt(p))
+				got, err := BinomialMod(n, r, p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want.Int64() {
+					t.Errorf("BinomialMod(%d, %d, %d) = %d, want %v", n, r, p, got, want)
+				}
+			}
+		}
+	}
+
+	// 巨大な n でも桁ごとに計算できる
+	if got, _ := BinomialMod(1_000_000_000_000, 500_000_000_000, 13); got < 0 || got >= 13 {
+		t.Errorf("BinomialMod with huge n = %d, out of range", got)
+	}
+}
+
+func BenchmarkNaiveFactorial10000(b *testing.B) {
+	for b.Loop() {
+		NaiveFactorial(10000)
+	}
+}
+
+func BenchmarkFastFactorial10000(b *testing.B) {
+	for b.Loop() {
+		FastFactorial(10000)
+	}
+}
+
+func BenchmarkNaiveFactorial100000(b *testing.B) {
+	for b.Loop() {
+		NaiveFactorial(100000)
+	}
+}
+
+func BenchmarkFastFactorial100000(b *testing.B) {
+	for b.Loop() {
+		FastFactorial(100000)
+	}
+}
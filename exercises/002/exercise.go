@@ -9,6 +9,7 @@ import (
 	"errors" // エラーを扱うための標準ライブラリ
 	"fmt"    // 入出力（表示など）を扱うパッケージ
 	"log"    // エラーログ出力用
+	"math"   // int の最大値を扱う
 )
 
 func main() {
@@ -28,8 +29,8 @@ func main() {
 		log.Fatal("Please enter a number") // エラーがあれば即終了
 	}
 
-	// 入力値を使って Exercise002 を実行
-	result, err := Exercise002(input)
+	// 入力値を使って 1!..n! の数列を計算（int に収まらない値も扱える）
+	result, err := Exercise002Sequence(input)
 
 	// 入力値が 0 以下などでエラーが返ってきたとき
 	if err != nil {
@@ -37,10 +38,11 @@ func main() {
 	}
 
 	// 計算結果を出力
-	fmt.Printf("Factorial of %d = %d", input, result)
+	fmt.Println(result)
 }
 
 // Exercise002 は、指定された数の階乗を返す関数
+// 結果が int に収まらないときは ErrOverflow を返す
 func Exercise002(input int) (int, error) {
 	if input < 1 {
 		// 負の数や 0 のときはエラーを返す
@@ -52,6 +54,10 @@ func Exercise002(input int) (int, error) {
 
 	// 1 から input まで掛け算していく
 	for i := 1; i <= input; i++ {
+		// 掛け算の前に int の範囲を超えないか確認する
+		if result > math.MaxInt/i {
+			return 0, ErrOverflow
+		}
 		result *= i
 	}
 
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// ErrOverflow は、階乗が int に収まらないときのエラー
+var ErrOverflow = errors.New("factorial overflows int")
+
+// FactorialCache は、計算済みの階乗を保持するキャッシュ（複数のゴルーチンから安全に使える）
+type FactorialCache struct {
+	mu     sync.RWMutex
+	values []*big.Int // values[i] = i!
+}
+
+// NewFactorialCache は、0! だけを持つキャッシュを作成する
+func NewFactorialCache() *FactorialCache {
+	return &FactorialCache{values: []*big.Int{big.NewInt(1)}}
+}
+
+// defaultCache は、パッケージ全体で共有するキャッシュ
+var defaultCache = NewFactorialCache()
+
+// extend は、n! までキャッシュを伸ばして 0!..n! を返す
+// 返したスライスの要素は書き換えないこと
+func (c *FactorialCache) extend(n int) []*big.Int {
+	// 1. 計算済みであれば読み取りロックだけで返す
+	c.mu.RLock()
+	if n < len(c.values) {
+		values := c.values[:n+1]
+		c.mu.RUnlock()
+		return values
+	}
+	c.mu.RUnlock()
+
+	// 2. 書き込みロックを取り、足りない分を計算する
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.values); i <= n; i++ {
+		next := new(big.Int).Mul(c.values[i-1], big.NewInt(int64(i)))
+		c.values = append(c.values, next)
+	}
+	return c.values[:n+1]
+}
+
+// Factorial は、n! を返す
+func (c *FactorialCache) Factorial(n int) (*big.Int, error) {
+	if n < 0 {
+		return nil, errors.New("input must be a non-negative integer")
+	}
+	// キャッシュの値を呼び出し側に書き換えられないようにコピーを返す
+	return new(big.Int).Set(c.extend(n)[n]), nil
+}
+
+// Sequence は、1!..n! を返す
+func (c *FactorialCache) Sequence(n int) ([]*big.Int, error) {
+	if n < 1 {
+		return nil, errors.New("input must be a positive integer")
+	}
+	values := c.extend(n)
+	result := make([]*big.Int, n)
+	for i := range result {
+		result[i] = new(big.Int).Set(values[i+1])
+	}
+	return result, nil
+}
+
+// FactorialSequence は、1!..n! を任意精度で返す
+func FactorialSequence(n int) ([]*big.Int, error) {
+	return defaultCache.Sequence(n)
+}
+
+// Exercise002Sequence は、1!..n! をカンマ区切りの文字列で返す
+func Exercise002Sequence(input int) (string, error) {
+	if input < 1 {
+		return "", errors.New("input must be a positive integer")
+	}
+	values := defaultCache.extend(input)
+
+	var sb strings.Builder
+	buf := []byte{}
+	for i := 1; i <= input; i++ {
+		if i > 1 {
+			sb.WriteByte(',')
+		}
+		buf = values[i].Append(buf[:0], 10)
+		sb.Write(buf)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestExercise002Overflow(t *testing.T) {
+	// 20! は int64 に収まる
+	got, err := Exercise002(20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := 2432902008176640000; got != want {
+		t.Errorf("Exercise002(20) = %v, want %v", got, want)
+	}
+
+	// 21! からは ErrOverflow
+	if _, err := Exercise002(21); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Exercise002(21) error = %v, want ErrOverflow", err)
+	}
+}
+
+func TestExercise002Sequence(t *testing.T) {
+	got, err := Exercise002Sequence(5)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "1,2,6,24,120"; got != want {
+		t.Errorf("Exercise002Sequence(5) = %q, want %q", got, want)
+	}
+
+	// 21! 以降も正しく計算できる
+	got, err = Exercise002Sequence(25)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	parts := strings.Split(got, ",")
+	if len(parts) != 25 {
+		t.Fatalf("Expected 25 values, got %d", len(parts))
+	}
+	if want := "51090942171709440000"; parts[20] != want {
+		t.Errorf("21! = %s, want %s", parts[20], want)
+	}
+	if want := "15511210043330985984000000"; parts[24] != want {
+		t.Errorf("25! = %s, want %s", parts[24], want)
+	}
+
+	if _, err := Exercise002Sequence(0); err == nil {
+		t.Error("Exercise002Sequence(0) should return error")
+	}
+}
+
+func TestFactorialCacheConcurrent(t *testing.T) {
+	cache := NewFactorialCache()
+	want, _ := new(big.Int).SetString("30414093201713378043612608166064768844377641568960512000000000000", 10)
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			seq, err := cache.Sequence(n)
+			if err != nil {
+				t.Errorf("Sequence(%d) failed: %v", n, err)
+				return
+			}
+			if len(seq) != n {
+				t.Errorf("Sequence(%d) returned %d values", n, len(seq))
+			}
+		}(i%50 + 1)
+	}
+	wg.Wait()
+
+	got, err := cache.Factorial(50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Cmp(want) != 0 {
+		t.Errorf("50! = %v, want %v", got, want)
+	}
+
+	// 返された値を書き換えてもキャッシュは壊れない
+	got.SetInt64(0)
+	again, _ := cache.Factorial(50)
+	if again.Cmp(want) != 0 {
+		t.Error("cache was modified through returned value")
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 /*
 Exercise 003
@@ -13,13 +16,29 @@ Exercise 003
 たとえば、次の入力が与えられたとします：8
 その場合、出力は次のようになります：
 map[1:1 2:4 3:9 4:16 5:25 6:36 7:49 8:64]
+
+結果はキーの昇順に並んだ OrderedMap で返すので、fmt でも JSON でも常に同じ順序で出力されます。
 */
 
 func main() {
 	fmt.Println("Exercise 003")
-	fmt.Println(Exercise003(8))
+	result := Exercise003(8)
+	fmt.Println(result)
+
+	// JSON でもキーの順序が保たれる
+	data, err := json.Marshal(result)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Println(string(data))
 }
 
-func Exercise003(n int) map[int]int {
-	return nil
+// Exercise003 は、1 から n までの i について i → i*i のマップをキーの昇順で返す
+func Exercise003(n int) *OrderedMap[int, int] {
+	result := NewOrderedMap[int, int](KeySorted)
+	for i := 1; i <= n; i++ {
+		result.Set(i, i*i)
+	}
+	return result
 }
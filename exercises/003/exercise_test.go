@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
 )
@@ -17,7 +18,19 @@ func TestExercise003(t *testing.T) {
 		8: 64,
 	}
 	got := Exercise003(8)
-	if !reflect.DeepEqual(want, got) {
+	if !reflect.DeepEqual(want, got.Map()) {
 		t.Errorf("Exercise003(8) = %v, want %v", got, want)
 	}
+
+	// 出力はどの形式でもキーの昇順になる
+	if s, want := got.String(), "map[1:1 2:4 3:9 4:16 5:25 6:36 7:49 8:64]"; s != want {
+		t.Errorf("Exercise003(8).String() = %q, want %q", s, want)
+	}
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, want := string(data), `{"1":1,"2":4,"3":9,"4":16,"5":25,"6":36,"7":49,"8":64}`; s != want {
+		t.Errorf("json.Marshal(Exercise003(8)) = %s, want %s", s, want)
+	}
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Order は、OrderedMap のキーの並び順
+type Order int
+
+const (
+	KeySorted      Order = iota // キーの昇順
+	InsertionOrder              // 追加した順
+)
+
+// OrderedMap は、キーの並び順が決まっているマップ（ゼロ値はキー昇順の空のマップ）
+type OrderedMap[K cmp.Ordered, V any] struct {
+	order  Order
+	keys   []K
+	values map[K]V
+}
+
+// NewOrderedMap は、指定した並び順の空の OrderedMap を作成する
+func NewOrderedMap[K cmp.Ordered, V any](order Order) *OrderedMap[K, V] {
+	return &OrderedMap[K, V]{order: order, values: map[K]V{}}
+}
+
+// Order は、並び順を返す
+func (m *OrderedMap[K, V]) Order() Order {
+	return m.order
+}
+
+// Len は、要素数を返す
+func (m *OrderedMap[K, V]) Len() int {
+	return len(m.keys)
+}
+
+// Set は、キーに値を設定する
+// 挿入順モードで既存のキーを上書きしたときは元の位置を保つ
+func (m *OrderedMap[K, V]) Set(key K, value V) {
+	if m.values == nil {
+		m.values = map[K]V{}
+	}
+	if _, ok := m.values[key]; !ok {
+		if m.order == KeySorted {
+			i, _ := slices.BinarySearch(m.keys, key)
+			m.keys = slices.Insert(m.keys, i, key)
+		} else {
+			m.keys = append(m.keys, key)
+		}
+	}
+	m.values[key] = value
+}
+
+// Get は、キーに対応する値を返す
+func (m *OrderedMap[K, V]) Get(key K) (V, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+// Delete は、キーを削除する
+func (m *OrderedMap[K, V]) Delete(key K) {
+	if _, ok := m.values[key]; !ok {
+		return
+	}
+	delete(m.values, key)
+	if m.order == KeySorted {
+		i, _ := slices.BinarySearch(m.keys, key)
+		m.keys = slices.Delete(m.keys, i, i+1)
+		return
+	}
+	m.keys = slices.DeleteFunc(m.keys, func(k K) bool { return k == key })
+}
+
+// Keys は、キーを並び順で返す
+func (m *OrderedMap[K, V]) Keys() []K {
+	return slices.Clone(m.keys)
+}
+
+// All は、キーと値の組を並び順で返すイテレーター
+func (m *OrderedMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for _, k := range m.keys {
+			if !yield(k, m.values[k]) {
+				return
+			}
+		}
+	}
+}
+
+// Map は、組み込みの map にコピーして返す
+func (m *OrderedMap[K, V]) Map() map[K]V {
+	result := make(map[K]V, len(m.keys))
+	for k, v := range m.All() {
+		result[k] = v
+	}
+	return result
+}
+
+// String は、fmt のマップ表示と同じ形式 map[k:v ...] を並び順で返す
+func (m *OrderedMap[K, V]) String() string {
+	var sb strings.Builder
+	sb.WriteString("map[")
+	for i, k := range m.keys {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		fmt.Fprintf(&sb, "%v:%v", k, m.values[k])
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
+// MarshalJSON は、並び順を保ったJSONオブジェクトを返す
+func (m *OrderedMap[K, V]) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		// JSON のキーは文字列なので、数値のキーも文字列にする
+		key, err := json.Marshal(formatKey(k))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(m.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON は、JSONオブジェクトを出現順に読み込む
+// 既存の要素は破棄し、並び順の設定は保つ
+func (m *OrderedMap[K, V]) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("OrderedMap: expected JSON object, got %v", tok)
+	}
+
+	m.keys = nil
+	m.values = map[K]V{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, err := parseKey[K](tok.(string))
+		if err != nil {
+			return err
+		}
+		var value V
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		m.Set(key, value)
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// formatKey は、キーをJSONオブジェクトのキー文字列にする
+func formatKey[K cmp.Ordered](k K) string {
+	switch v := any(k).(type) {
+	case string:
+		return v
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(k)
+}
+
+// parseKey は、JSONオブジェクトのキー文字列を K に変換する
+func parseKey[K cmp.Ordered](s string) (K, error) {
+	var k K
+	var err error
+	switch p := any(&k).(type) {
+	case *string:
+		*p = s
+	case *int:
+		*p, err = strconv.Atoi(s)
+	case *float64:
+		*p, err = strconv.ParseFloat(s, 64)
+	default:
+		// その他の数値型は fmt で読み取る
+		_, err = fmt.Sscan(s, &k)
+	}
+	if err != nil {
+		return k, fmt.Errorf("OrderedMap: invalid key %q: %w", s, err)
+	}
+	return k, nil
+}
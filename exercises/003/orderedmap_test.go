@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestOrderedMapKeySorted(t *testing.T) {
+	m := NewOrderedMap[string, int](KeySorted)
+	m.Set("banana", 2)
+	m.Set("apple", 1)
+	m.Set("cherry", 3)
+	m.Set("apple", 10)
+
+	if got, want := m.Keys(), []string{"apple", "banana", "cherry"}; !slices.Equal(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+	if v, ok := m.Get("apple"); !ok || v != 10 {
+		t.Errorf("Get(apple) = %d, %v; want 10, true", v, ok)
+	}
+
+	m.Delete("banana")
+	m.Delete("missing")
+	if got, want := m.String(), "map[apple:10 cherry:3]"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if m.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", m.Len())
+	}
+}
+
+func TestOrderedMapInsertionOrder(t *testing.T) {
+	m := NewOrderedMap[string, int](InsertionOrder)
+	m.Set("z", 1)
+	m.Set("a", 2)
+	m.Set("m", 3)
+	// 上書きしても位置は変わらない
+	m.Set("z", 4)
+	m.Delete("a")
+	m.Set("a", 5)
+
+	var keys []string
+	var values []int
+	for k, v := range m.All() {
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	if want := []string{"z", "m", "a"}; !slices.Equal(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+	if want := []int{4, 3, 5}; !slices.Equal(values, want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+
+	// 途中で止めても問題ない
+	for k := range m.All() {
+		if k != "z" {
+			t.Errorf("first key = %q, want z", k)
+		}
+		break
+	}
+}
+
+func TestOrderedMapJSON(t *testing.T) {
+	src := `{"zeta":1,"alpha":{"x":[1,2]},"mid":null}`
+
+	m := NewOrderedMap[string, any](InsertionOrder)
+	if err := json.Unmarshal([]byte(src), m); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if got, want := m.Keys(), []string{"zeta", "alpha", "mid"}; !slices.Equal(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != src {
+		t.Errorf("Marshal = %s, want %s", data, src)
+	}
+
+	// キー昇順モードでは読み込み時に並べ替える
+	sorted := NewOrderedMap[int, string](KeySorted)
+	if err := json.Unmarshal([]byte(`{"10":"b","2":"a","-1":"c"}`), sorted); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = json.Marshal(sorted)
+	if want := `{"-1":"c","2":"a","10":"b"}`; string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+
+	// 構造体のフィールドとしても使える
+	type wrapper struct {
+		Scores *OrderedMap[float64, bool] `json:"scores"`
+	}
+	w := wrapper{Scores: NewOrderedMap[float64, bool](KeySorted)}
+	w.Scores.Set(2.5, true)
+	w.Scores.Set(-0.5, false)
+	data, _ = json.Marshal(w)
+	if want := `{"scores":{"-0.5":false,"2.5":true}}`; string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+}
+
+func TestOrderedMapJSONErrors(t *testing.T) {
+	m := NewOrderedMap[int, int](KeySorted)
+	if err := json.Unmarshal([]byte(`[1,2]`), m); err == nil {
+		t.Error("expected error for JSON array")
+	}
+	if err := json.Unmarshal([]byte(`{"x":1}`), m); err == nil {
+		t.Error("expected error for non-integer key")
+	}
+	var u8 OrderedMap[uint8, int]
+	if err := json.Unmarshal([]byte(`{"7":1,"3":2}`), &u8); err != nil {
+		t.Fatalf("Unmarshal uint8 keys failed: %v", err)
+	}
+	// ゼロ値はキー昇順モード
+	if got := u8.Keys(); !slices.Equal(got, []uint8{3, 7}) {
+		t.Errorf("Keys() = %v, want [3 7]", got)
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"sync"
 )
 
@@ -34,6 +37,14 @@ func main() {
 	worker := &SimpleWorker{}
 	results := Exercise004(5, worker)
 	fmt.Println("Results:", results)
+
+	// 同時実行数を2に制限し、結果を id の順に並べる
+	ordered, err := Exercise004E(context.Background(), 5, AdaptWorker(worker), RunOptions{Concurrency: 2, Ordered: true})
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Println("Ordered results:", ordered)
 }
 
 // Worker インターフェースの定義
@@ -51,6 +62,8 @@ func (w *SimpleWorker) Process(id int) string {
 }
 
 // Exercise004 関数の実装
+// panic したジョブの結果は含まれない。panic の値とスタックトレースは log に出力する
+// （呼び出し側で失敗を扱う必要がある場合は RunAll を使う）
 func Exercise004(numWorkers int, worker Worker) []string {
 	if numWorkers <= 0 {
 		return []string{}
@@ -71,7 +84,16 @@ func Exercise004(numWorkers int, worker Worker) []string {
 		go func(id int) {
 			defer wg.Done()
 			// 4. 結果をチャネルに送信
-			result := worker.Process(id)
+			// Process が panic してもプロセス全体が落ちないように回復し、そのジョブの結果は捨てる
+			result, err := safeProcess(context.Background(), AdaptWorker(worker), id)
+			if err != nil {
+				var stack []byte
+				if panicErr := (*PanicError)(nil); errors.As(err, &panicErr) {
+					stack = panicErr.Stack
+				}
+				log.Printf("Exercise004: job %d: %v\n%s", id, err, stack)
+				return
+			}
 			results <- result
 		}(i)
 	}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrSkip は、Stage の処理関数が返すとその要素を次の段に流さずに捨てる
+var ErrSkip = errors.New("skip item")
+
+// StageError は、どの段で失敗したかを表すエラー
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Stage は、In を受け取って Out を返すパイプラインの1段
+type Stage[In, Out any] struct {
+	Name        string                                        // エラー表示用の名前
+	Process     func(ctx context.Context, in In) (Out, error) // 1要素の処理
+	Parallelism int                                           // この段で同時に動くゴルーチンの数（0以下なら1）
+	Buffer      int                                           // 次の段とのチャネルのバッファサイズ
+}
+
+// WorkerStage は、WorkerE を id → 結果文字列の Stage として使う
+func WorkerStage(worker WorkerE, parallelism int) Stage[int, string] {
+	return Stage[int, string]{
+		Name:        "worker",
+		Process:     worker.Process,
+		Parallelism: parallelism,
+	}
+}
+
+// Pipeline は、複数の段のゴルーチンをまとめて管理する
+// どこかの段が失敗するか Cancel されると全ての段が止まる
+type Pipeline struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+}
+
+// NewPipeline は、ctx に従って止まる Pipeline を作成する
+func NewPipeline(ctx context.Context) *Pipeline {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Pipeline{ctx: ctx, cancel: cancel}
+}
+
+// Context は、パイプラインが止まるとキャンセルされるコンテキストを返す
+func (p *Pipeline) Context() context.Context {
+	return p.ctx
+}
+
+// Cancel は、パイプラインの全ての段を止める
+func (p *Pipeline) Cancel() {
+	p.cancel(context.Canceled)
+}
+
+// Wait は、全ての段のゴルーチンが終わるのを待ち、最初のエラーを返す
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	var err error
+	if p.ctx.Err() != nil {
+		err = context.Cause(p.ctx)
+	}
+	p.cancel(nil)
+	return err
+}
+
+// goroutine は、Pipeline に管理されるゴルーチンを起動する
+func (p *Pipeline) goroutine(fn func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		fn()
+	}()
+}
+
+// send は、パイプラインが止まっていなければ v を送る
+func send[T any](p *Pipeline, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// receive は、パイプラインが止まっていなければ in から1つ受け取る
+func receive[T any](p *Pipeline, in <-chan T) (T, bool) {
+	select {
+	case v, ok := <-in:
+		return v, ok
+	case <-p.ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
+
+// Source は、items を流すチャネルを返す
+func Source[T any](p *Pipeline, items iter.Seq[T], buffer int) <-chan T {
+	out := make(chan T, buffer)
+	p.goroutine(func() {
+		defer close(out)
+		for v := range items {
+			if !send(p, out, v) {
+				return
+			}
+		}
+	})
+	return out
+}
+
+// Apply は、in の各要素に stage を適用した結果を流すチャネルを返す
+// Parallelism 個のゴルーチンが in を分け合って読み（ファンアウト）、同じ出力チャネルに書く（ファンイン）
+// 出力の順序は保証しない
+func Apply[In, Out any](p *Pipeline, in <-chan In, stage Stage[In, Out]) <-chan Out {
+	out := make(chan Out, max(stage.Buffer, 0))
+	n := max(stage.Parallelism, 1)
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for range n {
+		p.goroutine(func() {
+			defer wg.Done()
+			for {
+				v, ok := receive(p, in)
+				if !ok {
+					return
+				}
+				r, err := processStage(p.ctx, stage, v)
+				if errors.Is(err, ErrSkip) {
+					continue
+				}
+				if err != nil {
+					p.cancel(&StageError{Stage: stage.Name, Err: err})
+					return
+				}
+				if !send(p, out, r) {
+					return
+				}
+			}
+		})
+	}
+
+	// 全てのゴルーチンが終わったら出力チャネルを閉じる
+	p.goroutine(func() {
+		wg.Wait()
+		close(out)
+	})
+	return out
+}
+
+// processStage は、stage.Process の panic を PanicError に変換する
+func processStage[In, Out any](ctx context.Context, stage Stage[In, Out], v In) (r Out, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = &PanicError{Value: x, Stack: debug.Stack()}
+		}
+	}()
+	return stage.Process(ctx, v)
+}
+
+// Split は、in の要素を n 本のチャネルに分配する（各要素はどれか1本にだけ流れる）
+func Split[T any](p *Pipeline, in <-chan T, n int) []<-chan T {
+	outs := make([]<-chan T, n)
+	for i := range outs {
+		out := make(chan T)
+		outs[i] = out
+		p.goroutine(func() {
+			defer close(out)
+			for {
+				v, ok := receive(p, in)
+				if !ok || !send(p, out, v) {
+					return
+				}
+			}
+		})
+	}
+	return outs
+}
+
+// Merge は、複数のチャネルの要素を1本のチャネルにまとめる
+func Merge[T any](p *Pipeline, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+	var wg sync.WaitGroup
+	wg.Add(len(ins))
+	for _, in := range ins {
+		p.goroutine(func() {
+			defer wg.Done()
+			for {
+				v, ok := receive(p, in)
+				if !ok || !send(p, out, v) {
+					return
+				}
+			}
+		})
+	}
+	p.goroutine(func() {
+		wg.Wait()
+		close(out)
+	})
+	return out
+}
+
+// Collect は、in の要素を全て読み取り、パイプラインの終了を待って返す
+func Collect[T any](p *Pipeline, in <-chan T) ([]T, error) {
+	result := []T{}
+	for v := range in {
+		result = append(result, v)
+	}
+	if err := p.Wait(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
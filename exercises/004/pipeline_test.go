@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type record struct {
+	ID   int
+	Name string
+}
+
+func TestPipelineParseEnrichWrite(t *testing.T) {
+	p := NewPipeline(context.Background())
+	lines := Source(p, slices.Values([]string{"1,alice", "2,bob", "bad", "3,carol"}), 2)
+
+	// parse: 不正な行は捨てる
+	records := Apply(p, lines, Stage[string, record]{
+		Name: "parse",
+		Process: func(ctx context.Context, line string) (record, error) {
+			id, name, ok := strings.Cut(line, ",")
+			if !ok {
+				return record{}, ErrSkip
+			}
+			n, err := strconv.Atoi(id)
+			return record{ID: n, Name: name}, err
+		},
+		Parallelism: 2,
+		Buffer:      4,
+	})
+
+	// enrich
+	enriched := Apply(p, records, Stage[record, record]{
+		Name: "enrich",
+		Process: func(ctx context.Context, r record) (record, error) {
+			r.Name = strings.ToUpper(r.Name)
+			return r, nil
+		},
+		Parallelism: 3,
+	})
+
+	// write
+	written := Apply(p, enriched, Stage[record, string]{
+		Name: "write",
+		Process: func(ctx context.Context, r record) (string, error) {
+			return fmt.Sprintf("%d:%s", r.ID, r.Name), nil
+		},
+	})
+
+	got, err := Collect(p, written)
+	if err != nil {
+		t.Fatalf("pipeline failed: %v", err)
+	}
+	sort.Strings(got)
+	want := []string{"1:ALICE", "2:BOB", "3:CAROL"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pipeline output = %v, want %v", got, want)
+	}
+}
+
+func TestPipelineParallelism(t *testing.T) {
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	p := NewPipeline(context.Background())
+	ids := Source(p, slices.Values(make([]int, 30)), 0)
+	out := Apply(p, ids, Stage[int, int]{
+		Name: "slow",
+		Process: func(ctx context.Context, v int) (int, error) {
+			mu.Lock()
+			active++
+			maxActive = max(maxActive, active)
+			mu.Unlock()
+			time.Sleep(2 * time.Millisecond)
+			mu.Lock()
+			active--
+			mu.Unlock()
+			return v, nil
+		},
+		Parallelism: 4,
+	})
+
+	got, err := Collect(p, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 30 {
+		t.Errorf("got %d items, want 30", len(got))
+	}
+	if maxActive > 4 || maxActive < 2 {
+		t.Errorf("max active = %d, want between 2 and 4", maxActive)
+	}
+}
+
+func TestPipelineErrorStopsAllStages(t *testing.T) {
+	errBad := errors.New("bad item")
+	var processed atomic.Int32
+
+	p := NewPipeline(context.Background())
+	// 無限に値を流すソース
+	numbers := Source(p, func(yield func(int) bool) {
+		for i := 0; ; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}, 0)
+	checked := Apply(p, numbers, Stage[int, int]{
+		Name: "check",
+		Process: func(ctx context.Context, v int) (int, error) {
+			processed.Add(1)
+			if v == 10 {
+				return 0, errBad
+			}
+			return v, nil
+		},
+		Parallelism: 2,
+	})
+
+	_, err := Collect(p, checked)
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "check" || !errors.Is(err, errBad) {
+		t.Fatalf("error = %v, want StageError from check", err)
+	}
+	if n := processed.Load(); n > 100 {
+		t.Errorf("processed %d items after failure, expected the pipeline to stop", n)
+	}
+}
+
+func TestPipelineCancelDrains(t *testing.T) {
+	p := NewPipeline(context.Background())
+	blocked := make(chan struct{})
+	ids := Source(p, slices.Values([]int{1, 2, 3, 4, 5}), 0)
+	out := Apply(p, ids, Stage[int, int]{
+		Name: "block",
+		Process: func(ctx context.Context, v int) (int, error) {
+			if v == 1 {
+				close(blocked)
+			}
+			<-ctx.Done()
+			return 0, ctx.Err()
+		},
+		Parallelism: 2,
+	})
+
+	go func() {
+		<-blocked
+		p.Cancel()
+	}()
+
+	done := make(chan error)
+	go func() {
+		_, err := Collect(p, out)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pipeline did not drain after Cancel")
+	}
+}
+
+func TestPipelinePanicBecomesError(t *testing.T) {
+	p := NewPipeline(context.Background())
+	ids := Source(p, slices.Values([]int{0, 1, 2}), 0)
+	out := Apply(p, ids, WorkerStage(AdaptWorker(&PanicWorker{panicID: 1}), 1))
+
+	_, err := Collect(p, out)
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Errorf("error = %v, want PanicError", err)
+	}
+}
+
+func TestSplitMerge(t *testing.T) {
+	p := NewPipeline(context.Background())
+	numbers := Source(p, slices.Values([]int{1, 2, 3, 4, 5, 6, 7, 8}), 0)
+
+	// 3本に分けてそれぞれ別の処理をし、1本にまとめる
+	branches := Split(p, numbers, 3)
+	var outs []<-chan string
+	for i, branch := range branches {
+		outs = append(outs, Apply(p, branch, Stage[int, string]{
+			Name: fmt.Sprintf("branch-%d", i),
+			Process: func(ctx context.Context, v int) (string, error) {
+				return strconv.Itoa(v * v), nil
+			},
+		}))
+	}
+
+	got, err := Collect(p, Merge(p, outs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(got, func(i, j int) bool {
+		a, _ := strconv.Atoi(got[i])
+		b, _ := strconv.Atoi(got[j])
+		return a < b
+	})
+	want := []string{"1", "4", "9", "16", "25", "36", "49", "64"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Split/Merge output = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+// PanicError は、ジョブ内で発生した panic を表すエラー
+type PanicError struct {
+	Value any    // recover() で得た値
+	Stack []byte // panic 発生時のスタックトレース
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// RetryPolicy は、失敗したジョブの再試行方法
+type RetryPolicy struct {
+	MaxAttempts int              // 最大試行回数（1以下なら再試行しない）
+	Backoff     time.Duration    // 1回目の再試行までの待ち時間
+	Multiplier  float64          // 再試行ごとに待ち時間を何倍にするか（0なら2倍）
+	MaxBackoff  time.Duration    // 待ち時間の上限（0なら上限なし）
+	RetryIf     func(error) bool // 再試行するエラーかどうか（nilなら全て再試行する）
+}
+
+// delay は、attempt 回目の試行が失敗した後の待ち時間を返す
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	d := float64(p.Backoff)
+	for i := 1; i < attempt; i++ {
+		d *= multiplier
+		if p.MaxBackoff > 0 && d >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	return time.Duration(d)
+}
+
+// JobResult は、1つのジョブの実行結果
+type JobResult struct {
+	ID       int
+	Value    string
+	Err      error
+	Attempts int // 試行した回数
+}
+
+// Summary は、RunAll の結果の集計
+type Summary struct {
+	Results   []JobResult // 実行したジョブの結果（id順）
+	Succeeded []int       // 成功した id
+	Failed    []int       // 再試行しても失敗した id
+	Retried   []int       // 2回以上試行した id（最終的な成否は問わない）
+}
+
+// Err は、失敗したジョブのエラーをまとめて返す（全て成功していれば nil）
+func (s Summary) Err() error {
+	var errs []error
+	for _, r := range s.Results {
+		if r.Err != nil {
+			errs = append(errs, &JobError{ID: r.ID, Err: r.Err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newSummary は、ジョブの結果を id 順に並べて集計する
+func newSummary(results []JobResult) Summary {
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+	s := Summary{Results: results, Succeeded: []int{}, Failed: []int{}, Retried: []int{}}
+	for _, r := range results {
+		if r.Err != nil {
+			s.Failed = append(s.Failed, r.ID)
+		} else {
+			s.Succeeded = append(s.Succeeded, r.ID)
+		}
+		if r.Attempts > 1 {
+			s.Retried = append(s.Retried, r.ID)
+		}
+	}
+	return s
+}
+
+// runJob は、1つのジョブを再試行方針に従って実行する
+func runJob(ctx context.Context, worker WorkerE, id int, policy RetryPolicy) JobResult {
+	r := JobResult{ID: id}
+	for {
+		r.Attempts++
+		r.Value, r.Err = safeProcess(ctx, worker, id)
+		if r.Err == nil || r.Attempts >= policy.MaxAttempts {
+			return r
+		}
+		if policy.RetryIf != nil && !policy.RetryIf(r.Err) {
+			return r
+		}
+
+		// 待ち時間の間にキャンセルされたらやめる
+		timer := time.NewTimer(policy.delay(r.Attempts))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return r
+		}
+	}
+}
+
+// safeProcess は、worker.Process の panic を PanicError に変換する
+func safeProcess(ctx context.Context, worker WorkerE, id int) (value string, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return worker.Process(ctx, id)
+}
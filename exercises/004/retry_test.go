@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// PanicWorker は、指定した id で panic する Worker
+type PanicWorker struct {
+	panicID int
+}
+
+func (w *PanicWorker) Process(id int) string {
+	if id == w.panicID {
+		panic(fmt.Sprintf("bad id %d", id))
+	}
+	return fmt.Sprintf("Processed: %d", id)
+}
+
+func TestExercise004RecoversPanic(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	results := Exercise004(4, &PanicWorker{panicID: 2})
+	sort.Strings(results)
+	want := []string{"Processed: 0", "Processed: 1", "Processed: 3"}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Exercise004 = %v, want %v", results, want)
+	}
+	// 結果から外したジョブの panic はスタックトレースと一緒に log に出る
+	if out := logged.String(); !strings.Contains(out, "job 2: panic: bad id 2") || !strings.Contains(out, "PanicWorker") {
+		t.Errorf("log output = %q", out)
+	}
+}
+
+func TestExercise004EPanicError(t *testing.T) {
+	_, err := Exercise004E(context.Background(), 3, AdaptWorker(&PanicWorker{panicID: 1}), RunOptions{})
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("error = %v, want PanicError", err)
+	}
+	if panicErr.Value != "bad id 1" {
+		t.Errorf("panic value = %v, want %q", panicErr.Value, "bad id 1")
+	}
+	if !strings.Contains(string(panicErr.Stack), "PanicWorker") {
+		t.Errorf("stack trace does not mention the panicking worker:\n%s", panicErr.Stack)
+	}
+	var jobErr *JobError
+	if !errors.As(err, &jobErr) || jobErr.ID != 1 {
+		t.Errorf("error = %v, want JobError for id 1", err)
+	}
+}
+
+// flakyWorker は、id ごとに指定回数だけ失敗してから成功する
+type flakyWorker struct {
+	mu       sync.Mutex
+	failures map[int]int
+	calls    map[int]int
+}
+
+func (w *flakyWorker) Process(ctx context.Context, id int) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.calls[id]++
+	if w.calls[id] <= w.failures[id] {
+		if id == 3 {
+			panic("flaky panic")
+		}
+		return "", fmt.Errorf("attempt %d failed", w.calls[id])
+	}
+	return fmt.Sprint(id), nil
+}
+
+func TestRunAllSummary(t *testing.T) {
+	worker := &flakyWorker{
+		failures: map[int]int{1: 1, 3: 2, 4: 10},
+		calls:    map[int]int{},
+	}
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	summary := RunAll(context.Background(), 5, worker, RunOptions{Concurrency: 2, Retry: policy})
+
+	if want := []int{0, 1, 2, 3}; !reflect.DeepEqual(summary.Succeeded, want) {
+		t.Errorf("Succeeded = %v, want %v", summary.Succeeded, want)
+	}
+	if want := []int{4}; !reflect.DeepEqual(summary.Failed, want) {
+		t.Errorf("Failed = %v, want %v", summary.Failed, want)
+	}
+	if want := []int{1, 3, 4}; !reflect.DeepEqual(summary.Retried, want) {
+		t.Errorf("Retried = %v, want %v", summary.Retried, want)
+	}
+	if got := summary.Results[4].Attempts; got != 3 {
+		t.Errorf("job 4 attempts = %d, want 3", got)
+	}
+	if got := summary.Results[3].Value; got != "3" {
+		t.Errorf("job 3 value = %q, want %q", got, "3")
+	}
+	if err := summary.Err(); err == nil || !strings.Contains(err.Error(), "job 4") {
+		t.Errorf("Err() = %v, want error for job 4", err)
+	}
+}
+
+func TestRunAllRetryIf(t *testing.T) {
+	errFatal := errors.New("fatal")
+	calls := 0
+	worker := WorkerEFunc(func(ctx context.Context, id int) (string, error) {
+		calls++
+		return "", errFatal
+	})
+	policy := RetryPolicy{
+		MaxAttempts: 5,
+		RetryIf:     func(err error) bool { return !errors.Is(err, errFatal) },
+	}
+
+	summary := RunAll(context.Background(), 1, worker, RunOptions{Retry: policy})
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1 for non-retryable error", calls)
+	}
+	if len(summary.Retried) != 0 || len(summary.Failed) != 1 {
+		t.Errorf("summary = %+v", summary)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	want := []time.Duration{10, 20, 40, 50, 50}
+	for i, w := range want {
+		if got := p.delay(i + 1); got != w*time.Millisecond {
+			t.Errorf("delay(%d) = %v, want %v", i+1, got, w*time.Millisecond)
+		}
+	}
+
+	p = RetryPolicy{Backoff: time.Second, Multiplier: 1.5}
+	if got := p.delay(3); got != 2250*time.Millisecond {
+		t.Errorf("delay(3) = %v, want 2.25s", got)
+	}
+}
+
+func TestRunAllCancelDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	worker := WorkerEFunc(func(ctx context.Context, id int) (string, error) {
+		return "", errors.New("always fails")
+	})
+
+	start := time.Now()
+	summary := RunAll(ctx, 1, worker, RunOptions{Retry: RetryPolicy{MaxAttempts: 10, Backoff: time.Hour}})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("RunAll took %v, expected to stop on cancellation", elapsed)
+	}
+	if len(summary.Failed) != 1 || summary.Results[0].Attempts != 1 {
+		t.Errorf("summary = %+v", summary)
+	}
+}
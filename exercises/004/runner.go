@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// WorkerE は、キャンセルに対応し、エラーを返せる Worker
+type WorkerE interface {
+	Process(ctx context.Context, id int) (string, error)
+}
+
+// WorkerEFunc は、関数を WorkerE として使うためのアダプター
+type WorkerEFunc func(ctx context.Context, id int) (string, error)
+
+// Process は、f(ctx, id) を呼ぶ
+func (f WorkerEFunc) Process(ctx context.Context, id int) (string, error) {
+	return f(ctx, id)
+}
+
+// AdaptWorker は、Worker を失敗しない WorkerE として包む
+func AdaptWorker(w Worker) WorkerE {
+	return WorkerEFunc(func(ctx context.Context, id int) (string, error) {
+		return w.Process(id), nil
+	})
+}
+
+// JobError は、どの id の処理で失敗したかを表すエラー
+type JobError struct {
+	ID  int
+	Err error
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("job %d: %v", e.ID, e.Err)
+}
+
+func (e *JobError) Unwrap() error {
+	return e.Err
+}
+
+// RunOptions は、Exercise004E と RunAll の実行方法
+type RunOptions struct {
+	Concurrency int         // 同時に実行するゴルーチンの上限（0以下なら全ジョブを同時に実行）
+	Ordered     bool        // true なら結果を id の順に並べる
+	Retry       RetryPolicy // 失敗したジョブの再試行方法（ゼロ値なら再試行しない）
+}
+
+// Exercise004E は、0 から numJobs-1 までの id を worker で並行処理する
+// 最初のエラーまたは ctx のキャンセルで残りの処理を止め、そのエラーを返す
+func Exercise004E(ctx context.Context, numJobs int, worker WorkerE, opts RunOptions) ([]string, error) {
+	if numJobs <= 0 {
+		return []string{}, nil
+	}
+	results, err := runJobs(ctx, numJobs, worker, opts, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Ordered {
+		sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+	}
+	finalResults := make([]string, len(results))
+	for i, r := range results {
+		finalResults[i] = r.Value
+	}
+	return finalResults, nil
+}
+
+// RunAll は、1つのジョブが失敗しても残りのジョブを続けて実行し、結果の集計を返す
+// ctx がキャンセルされた場合は、まだ始まっていないジョブを実行せずに終わる
+func RunAll(ctx context.Context, numJobs int, worker WorkerE, opts RunOptions) Summary {
+	results, _ := runJobs(ctx, max(numJobs, 0), worker, opts, false)
+	return newSummary(results)
+}
+
+// runJobs は、ワーカープールで id を処理し、完了した順に結果を返す
+// stopOnError が true のときは最初のエラーで残りの処理を止め、そのエラーを返す
+func runJobs(ctx context.Context, numJobs int, worker WorkerE, opts RunOptions, stopOnError bool) ([]JobResult, error) {
+	if numJobs == 0 {
+		return []JobResult{}, nil
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 || concurrency > numJobs {
+		concurrency = numJobs
+	}
+
+	// 1. 最初のエラーで他のゴルーチンを止めるためのコンテキスト
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	ids := make(chan int)
+	results := make(chan JobResult, concurrency)
+
+	// 2. concurrency 個のゴルーチンが id を受け取って処理する
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for range concurrency {
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				if ctx.Err() != nil {
+					return
+				}
+				r := runJob(ctx, worker, id, opts.Retry)
+				if r.Err != nil && stopOnError {
+					cancel(&JobError{ID: id, Err: r.Err})
+					return
+				}
+				results <- r
+			}
+		}()
+	}
+
+	// 3. id を順に配り、キャンセルされたら配るのをやめる
+	go func() {
+		defer close(ids)
+		for id := range numJobs {
+			select {
+			case ids <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// 4. 全ゴルーチンの終了後に結果チャネルを閉じる
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// 5. 結果を集める
+	finalResults := make([]JobResult, 0, numJobs)
+	for r := range results {
+		finalResults = append(finalResults, r)
+	}
+	if len(finalResults) < numJobs {
+		return finalResults, context.Cause(ctx)
+	}
+	return finalResults, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExercise004EOrdered(t *testing.T) {
+	// 後の id ほど早く終わるようにして、順序が保たれるか確認する
+	worker := WorkerEFunc(func(ctx context.Context, id int) (string, error) {
+		time.Sleep(time.Duration(10-id) * time.Millisecond)
+		return fmt.Sprintf("Processed: %d", id), nil
+	})
+
+	results, err := Exercise004E(context.Background(), 10, worker, RunOptions{Ordered: true})
+	if err != nil {
+		t.Fatalf("Exercise004E failed: %v", err)
+	}
+	for i, r := range results {
+		if want := fmt.Sprintf("Processed: %d", i); r != want {
+			t.Errorf("results[%d] = %q, want %q", i, r, want)
+		}
+	}
+}
+
+func TestExercise004EUnordered(t *testing.T) {
+	results, err := Exercise004E(context.Background(), 5, AdaptWorker(&SimpleWorker{}), RunOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatalf("Exercise004E failed: %v", err)
+	}
+	sort.Strings(results)
+	want := []string{"Processed: 0", "Processed: 1", "Processed: 2", "Processed: 3", "Processed: 4"}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Exercise004E = %v, want %v", results, want)
+	}
+
+	results, err = Exercise004E(context.Background(), 0, AdaptWorker(&SimpleWorker{}), RunOptions{})
+	if err != nil || len(results) != 0 {
+		t.Errorf("Exercise004E(0) = %v, %v; want empty", results, err)
+	}
+}
+
+func TestExercise004EConcurrencyLimit(t *testing.T) {
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	worker := WorkerEFunc(func(ctx context.Context, id int) (string, error) {
+		mu.Lock()
+		active++
+		maxActive = max(maxActive, active)
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return "", nil
+	})
+
+	if _, err := Exercise004E(context.Background(), 20, worker, RunOptions{Concurrency: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if maxActive > 3 {
+		t.Errorf("max concurrent workers = %d, want <= 3", maxActive)
+	}
+	if maxActive < 2 {
+		t.Errorf("max concurrent workers = %d, expected concurrent execution", maxActive)
+	}
+}
+
+func TestExercise004EFirstErrorStops(t *testing.T) {
+	errBoom := errors.New("boom")
+	var processed atomic.Int32
+	worker := WorkerEFunc(func(ctx context.Context, id int) (string, error) {
+		processed.Add(1)
+		if id == 2 {
+			return "", errBoom
+		}
+		return fmt.Sprint(id), nil
+	})
+
+	results, err := Exercise004E(context.Background(), 100, worker, RunOptions{Concurrency: 1})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("error = %v, want errBoom", err)
+	}
+	var jobErr *JobError
+	if !errors.As(err, &jobErr) || jobErr.ID != 2 {
+		t.Errorf("error = %v, want JobError for id 2", err)
+	}
+	if results != nil {
+		t.Errorf("results = %v, want nil on error", results)
+	}
+	if n := processed.Load(); n != 3 {
+		t.Errorf("processed %d jobs, want 3", n)
+	}
+}
+
+func TestExercise004ECancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var started atomic.Int32
+	worker := WorkerEFunc(func(ctx context.Context, id int) (string, error) {
+		if started.Add(1) == 2 {
+			cancel()
+		}
+		// キャンセルされるまで待つ
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+
+	_, err := Exercise004E(ctx, 50, worker, RunOptions{Concurrency: 2})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	if n := started.Load(); n > 2 {
+		t.Errorf("started %d jobs after cancellation, want <= 2", n)
+	}
+}
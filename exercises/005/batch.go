@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// batchIdleTimeout は、バッチのボディを読んでいる間、次のデータが届くまで待つ時間
+// サーバーの ReadTimeout と WriteTimeout はリクエスト全体にかかるので、大きなバッチの途中で切れないように
+// データが届くたびに読み取りと書き込みの期限をここから延ばす
+const batchIdleTimeout = 30 * time.Second
+
+// バッチの各行の結果
+const (
+	batchCreated  = "created"  // 追加した
+	batchConflict = "conflict" // ID またはメールアドレスが既に使われている
+	batchInvalid  = "invalid"  // JSON として読めない、またはフィールドが不正
+	batchSkipped  = "skipped"  // all-or-nothing で他の行が失敗したので追加しなかった
+)
+
+// BatchResult は、バッチの1行の結果
+type BatchResult struct {
+	Line          int            `json:"line"` // 1 から数えた行番号
+	Status        string         `json:"status"`
+	ID            int            `json:"id,omitempty"`
+	Reason        string         `json:"reason,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+}
+
+// BatchReport は、バッチ全体の結果
+type BatchReport struct {
+	Atomic     bool          `json:"atomic"`
+	Created    int           `json:"created"`
+	Conflicts  int           `json:"conflicts"`
+	Invalid    int           `json:"invalid"`
+	RolledBack bool          `json:"rolled_back"`     // all-or-nothing で失敗したので1人も追加しなかった
+	Error      string        `json:"error,omitempty"` // ボディを最後まで読めなかったときの理由
+	Results    []BatchResult `json:"results"`
+}
+
+// ImportUsers は、NDJSON を1行ずつ読み、検証して追加する
+// atomic が true なら、正しい行を全て読み終えるまで溜めておき、AddUsers で1回のロックの中でまとめて追加する
+// 1行でも失敗したときは1人も追加しないので、他のリクエストから途中の状態が見えることはない
+func (um *UserManager) ImportUsers(r io.Reader, atomic bool) BatchReport {
+	report := BatchReport{Atomic: atomic, Results: []BatchResult{}}
+	failed := false
+	var staged []User  // atomic のときに追加を待っているユーザー
+	var stagedAt []int // staged の各ユーザーの report.Results の中での位置
+
+	br := bufio.NewReaderSize(r, 4096)
+	for lineNo := 1; ; lineNo++ {
+		line, tooLong, err := readLine(br, maxUserBodyBytes)
+		if err != nil && !errors.Is(err, io.EOF) {
+			report.Error = err.Error()
+			failed = true
+			break
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 || tooLong {
+			result := BatchResult{Line: lineNo}
+			user, perr := parseUser(trimmed)
+			if tooLong {
+				perr = errors.New("Line exceeds " + strconv.Itoa(maxUserBodyBytes) + " bytes")
+			}
+
+			var invalid *ValidationError
+			switch {
+			case errors.As(perr, &invalid):
+				result.Status, result.Reason, result.InvalidParams = batchInvalid, "One or more fields are invalid", invalid.Params
+			case perr != nil:
+				result.Status, result.Reason = batchInvalid, perr.Error()
+			case atomic:
+				staged = append(staged, user)
+				stagedAt = append(stagedAt, len(report.Results))
+			default:
+				added, aerr := um.AddUser(user)
+				switch {
+				case errors.Is(aerr, ErrIDTaken), errors.Is(aerr, ErrEmailTaken):
+					result.Status, result.Reason = batchConflict, aerr.Error()
+				case aerr != nil:
+					result.Status, result.Reason = batchInvalid, aerr.Error()
+				default:
+					result.Status, result.ID = batchCreated, added.ID
+				}
+			}
+			report.add(result)
+			if result.Status == batchConflict || result.Status == batchInvalid {
+				failed = true
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+
+	if atomic {
+		um.commitStaged(&report, staged, stagedAt, failed)
+	}
+	return report
+}
+
+// add は、1行の結果を足して集計する
+func (report *BatchReport) add(result BatchResult) {
+	switch result.Status {
+	case batchConflict:
+		report.Conflicts++
+	case batchInvalid:
+		report.Invalid++
+	case batchCreated:
+		report.Created++
+	}
+	report.Results = append(report.Results, result)
+}
+
+// commitStaged は、all-or-nothing のバッチで溜めておいたユーザーをまとめて追加し、結果を埋める
+// 既に他の行が失敗していれば追加せず、重複だけを調べて報告する
+func (um *UserManager) commitStaged(report *BatchReport, staged []User, stagedAt []int, failed bool) {
+	added, conflicts, err := um.addUsers(staged, !failed)
+	if err != nil {
+		report.Error = err.Error()
+	}
+	report.RolledBack = failed || conflicts != nil || err != nil
+	for i, at := range stagedAt {
+		result := &report.Results[at]
+		switch {
+		case conflicts != nil && conflicts[i] != nil:
+			result.Status, result.Reason = batchConflict, conflicts[i].Error()
+			report.Conflicts++
+		case report.RolledBack:
+			result.Status, result.Reason = batchSkipped, "Not inserted because the batch is rolled back"
+		default:
+			result.Status, result.ID = batchCreated, added[i].ID
+			report.Created++
+		}
+	}
+}
+
+// readLine は、改行までの1行を返す（改行は含まない）
+// limit バイトを超える行は読み飛ばし、tooLong を true にする
+func readLine(br *bufio.Reader, limit int) (line []byte, tooLong bool, err error) {
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if !tooLong {
+			// 改行を除いた長さで比べる（最後の行に改行がなくても同じ上限にする）
+			if len(line)+len(bytes.TrimSuffix(chunk, []byte("\n"))) > limit {
+				// 行全体を溜めずに残りを読み飛ばす
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		return bytes.TrimSuffix(line, []byte("\n")), tooLong, err
+	}
+}
+
+// handleImportUsers ハンドラーの実装（POST /users:batch）
+// ?atomic=true で all-or-nothing になる
+func (um *UserManager) handleImportUsers(w http.ResponseWriter, r *http.Request) {
+	// 1. Content-Type は NDJSON（省略してもよい）
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if alias, ok := mediaAliases[mediaType]; ok {
+			mediaType = alias
+		}
+		if err != nil || mediaType != mediaNDJSON {
+			w.Header().Set("Accept-Post", mediaNDJSON)
+			writeError(w, http.StatusUnsupportedMediaType, "Batch import requires "+mediaNDJSON)
+			return
+		}
+	}
+	atomic := false
+	if s := r.URL.Query().Get("atomic"); s != "" {
+		var err error
+		if atomic, err = strconv.ParseBool(s); err != nil {
+			writeError(w, http.StatusBadRequest, "atomic must be a boolean")
+			return
+		}
+	}
+
+	// 2. ボディを溜めずに1行ずつ追加する（データが届く限りサーバーの期限では切らない）
+	rc := http.NewResponseController(w)
+	report := um.ImportUsers(&deadlineReader{r: r.Body, rc: rc}, atomic)
+	rc.SetWriteDeadline(time.Now().Add(batchIdleTimeout))
+
+	// 3. 結果を返す（取り消したときは 422、ボディを最後まで読めなかったときは 400）
+	status := http.StatusOK
+	switch {
+	case report.RolledBack:
+		status = http.StatusUnprocessableEntity
+	case report.Error != "":
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// deadlineReader は、読むたびに接続の読み取りと書き込みの期限を batchIdleTimeout だけ先に延ばす
+// 期限を変えられない ResponseWriter（httptest.ResponseRecorder など）では何もしない
+type deadlineReader struct {
+	r  io.Reader
+	rc *http.ResponseController
+}
+
+func (d *deadlineReader) Read(p []byte) (int, error) {
+	deadline := time.Now().Add(batchIdleTimeout)
+	d.rc.SetReadDeadline(deadline)
+	d.rc.SetWriteDeadline(deadline)
+	return d.r.Read(p)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statuses は、行ごとの結果を "行番号:状態" の並びにする
+func statuses(report BatchReport) []string {
+	var result []string
+	for _, r := range report.Results {
+		result = append(result, strconv.Itoa(r.Line)+":"+r.Status)
+	}
+	return result
+}
+
+const batchBody = `{"name":"Carol","email":"carol@example.com"}
+{"name":"Dave","email":"alice@example.com"}
+
+{"name":"","email":"bad"}
+not json
+{"name":"Eve","email":"eve@example.com"}
+`
+
+func TestImportUsers(t *testing.T) {
+	manager := newTestManager()
+	report := manager.ImportUsers(strings.NewReader(batchBody), false)
+
+	want := []string{"1:created", "2:conflict", "4:invalid", "5:invalid", "6:created"}
+	if got := statuses(report); !reflect.DeepEqual(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+	if report.Created != 2 || report.Conflicts != 1 || report.Invalid != 2 || report.RolledBack {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if params := report.Results[2].InvalidParams; len(params) != 2 {
+		t.Errorf("Expected name and email to be invalid, got %+v", params)
+	}
+	if report.Results[1].Reason != ErrEmailTaken.Error() {
+		t.Errorf("conflict reason = %q", report.Results[1].Reason)
+	}
+	if n := len(manager.GetAllUsers()); n != 4 {
+		t.Errorf("Expected 4 users, got %d", n)
+	}
+}
+
+func TestImportUsersAtomic(t *testing.T) {
+	manager := newTestManager()
+	report := manager.ImportUsers(strings.NewReader(batchBody), true)
+
+	want := []string{"1:skipped", "2:conflict", "4:invalid", "5:invalid", "6:skipped"}
+	if got := statuses(report); !reflect.DeepEqual(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+	if !report.RolledBack || report.Created != 0 || report.Conflicts != 1 || report.Invalid != 2 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if n := len(manager.GetAllUsers()); n != 2 {
+		t.Errorf("Expected rollback to leave 2 users, got %d", n)
+	}
+
+	// バッチの中での重複も、1人も追加せずに報告する
+	report = manager.ImportUsers(strings.NewReader(`{"id":3,"name":"Carol","email":"carol@example.com"}`+"\n"+`{"id":3,"name":"Dave","email":"CAROL@example.com"}`+"\n"+`{"name":"Eve","email":"eve@example.com"}`), true)
+	if got := statuses(report); !reflect.DeepEqual(got, []string{"1:skipped", "2:conflict", "3:skipped"}) || !report.RolledBack {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if n := len(manager.GetAllUsers()); n != 2 {
+		t.Errorf("Expected no users to be added, got %d", n)
+	}
+
+	// 全て成功すれば追加される
+	report = manager.ImportUsers(strings.NewReader(`{"name":"Carol","email":"carol@example.com"}`+"\r\n"+`{"id":9,"name":"Dave","email":"dave@example.com"}`), true)
+	if report.RolledBack || report.Created != 2 || report.Results[1].ID != 9 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
+
+func TestAddUsers(t *testing.T) {
+	manager := newTestManager()
+
+	// 1人ずつ追加したときと同じく、自動で割り当てた ID と後ろの行で指定した ID は重複する
+	added, conflicts, err := manager.AddUsers([]User{
+		{Name: "Carol", Email: "carol@example.com"},
+		{ID: 3, Name: "Dave", Email: "dave@example.com"},
+	})
+	if err != nil || added != nil || !reflect.DeepEqual(conflicts, []error{nil, ErrIDTaken}) {
+		t.Errorf("AddUsers = %v, %v, %v", added, conflicts, err)
+	}
+	if n := len(manager.GetAllUsers()); n != 2 {
+		t.Errorf("Expected no users to be added, got %d", n)
+	}
+
+	added, conflicts, err = manager.AddUsers([]User{
+		{ID: 3, Name: "Carol", Email: "carol@example.com"},
+		{Name: "Dave", Email: "dave@example.com"},
+	})
+	if err != nil || conflicts != nil || len(added) != 2 || added[1].ID != 4 {
+		t.Errorf("AddUsers = %v, %v, %v", added, conflicts, err)
+	}
+	if user, ok := manager.GetUser(4); !ok || user.Name != "Dave" {
+		t.Errorf("GetUser(4) = %+v, %v", user, ok)
+	}
+}
+
+// failingReader は、data を返した後にエラーを返す
+type failingReader struct {
+	data io.Reader
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if errors.Is(err, io.EOF) {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestImportUsersReadError(t *testing.T) {
+	manager := &UserManager{}
+	body := `{"name":"Carol","email":"carol@example.com"}` + "\n" + `{"name":"Da`
+	report := manager.ImportUsers(&failingReader{strings.NewReader(body)}, true)
+	if report.Error == "" || !report.RolledBack || len(manager.GetAllUsers()) != 0 {
+		t.Errorf("Expected read error to roll back, got %+v", report)
+	}
+}
+
+func TestReadLineLongLines(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+	br := bufio.NewReaderSize(strings.NewReader(long+"\nshort\n"+long), 16)
+
+	line, tooLong, err := readLine(br, 100)
+	if !tooLong || line != nil || err != nil {
+		t.Errorf("first line = %d bytes, tooLong %v, err %v", len(line), tooLong, err)
+	}
+	line, tooLong, err = readLine(br, 100)
+	if string(line) != "short" || tooLong || err != nil {
+		t.Errorf("second line = %q, tooLong %v, err %v", line, tooLong, err)
+	}
+	line, tooLong, err = readLine(br, 20000)
+	if len(line) != len(long) || tooLong || err != io.EOF {
+		t.Errorf("last line = %d bytes, tooLong %v, err %v", len(line), tooLong, err)
+	}
+
+	// 改行のない最後の行も、改行のある行と同じく limit バイトまで
+	for _, body := range []string{long[:101] + "\n", long[:101]} {
+		br = bufio.NewReaderSize(strings.NewReader(body), 16)
+		if line, tooLong, _ := readLine(br, 100); !tooLong || line != nil {
+			t.Errorf("%q: line = %d bytes, tooLong %v", body, len(line), tooLong)
+		}
+	}
+	br = bufio.NewReaderSize(strings.NewReader(long[:100]), 16)
+	if line, tooLong, _ := readLine(br, 100); tooLong || len(line) != 100 {
+		t.Errorf("100 byte last line = %d bytes, tooLong %v", len(line), tooLong)
+	}
+}
+
+func TestHandleImportUsers(t *testing.T) {
+	manager := newTestManager()
+	long := `{"name":"` + strings.Repeat("x", maxUserBodyBytes) + `"}`
+	body := long + "\n" + `{"name":"Carol","email":"carol@example.com"}` + "\n"
+
+	rr := serve(manager, "POST", "/users:batch", body, map[string]string{"Content-Type": "application/x-ndjson"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var report BatchReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(report); !reflect.DeepEqual(got, []string{"1:invalid", "2:created"}) {
+		t.Errorf("statuses = %v", got)
+	}
+
+	rr = serve(manager, "POST", "/users:batch?atomic=true", `{"name":"Carol","email":"carol@example.com"}`, nil)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected atomic conflict to return 422, got %d", rr.Code)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		method  string
+		headers map[string]string
+		status  int
+	}{
+		{"bad atomic", "/users:batch?atomic=maybe", "POST", nil, http.StatusBadRequest},
+		{"unsupported type", "/users:batch", "POST", map[string]string{"Content-Type": "text/csv"}, http.StatusUnsupportedMediaType},
+		{"method", "/users:batch", "GET", nil, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(manager, tt.method, tt.path, "", tt.headers)
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleImportUsersOutlivesServerTimeouts(t *testing.T) {
+	// ボディ全体はサーバーの ReadTimeout と WriteTimeout より長くかかる
+	server := NewServer(&UserManager{}, ServerConfig{Addr: "127.0.0.1:0", ReadTimeout: 200 * time.Millisecond, WriteTimeout: 200 * time.Millisecond})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown(context.Background())
+
+	pr, pw := io.Pipe()
+	go func() {
+		for i := range 6 {
+			time.Sleep(100 * time.Millisecond)
+			fmt.Fprintf(pw, `{"name":"User %d","email":"user%d@example.com"}`+"\n", i, i)
+		}
+		pw.Close()
+	}()
+	resp, err := http.Post("http://"+server.Addr()+"/users:batch", "application/x-ndjson", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var report BatchReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || report.Created != 6 || report.Error != "" {
+		t.Errorf("Unexpected response %d %+v", resp.StatusCode, report)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// userIDFromPath は、/users/{id} から ID を取り出す
+func userIDFromPath(r *http.Request) (int, error) {
+	return strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/users/"))
+}
+
+// writeUser は、ユーザーを指定したステータスと media の形式で返す
+func writeUser(w http.ResponseWriter, media string, status int, user User) {
+	data, err := encodeUser(media, user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	w.Header().Set("Content-Type", contentTypes[media])
+	w.Header().Set("ETag", computeETag(data))
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// writeUpdateError は、UpdateUserFunc / DeleteUserFunc のエラーをステータスコードに変換して返す
+func writeUpdateError(w http.ResponseWriter, r *http.Request, err error) {
+	var badRequest *badRequestError
+	var invalid *ValidationError
+	switch {
+	case errors.Is(err, ErrPreconditionFailed),
+		// 存在しないユーザーには If-Match のどの ETag も一致しない
+		errors.Is(err, ErrUserNotFound) && r.Header.Get("If-Match") != "":
+		writeError(w, http.StatusPreconditionFailed, "If-Match does not match the current user")
+	case errors.Is(err, ErrUserNotFound):
+		writeError(w, http.StatusNotFound, "User not found")
+	case errors.Is(err, ErrEmailTaken):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.As(err, &badRequest):
+		writeError(w, http.StatusBadRequest, badRequest.message)
+	case errors.As(err, &invalid):
+		writeValidationError(w, invalid)
+	default:
+		writeError(w, http.StatusInternalServerError, "Internal Server Error")
+	}
+}
+
+// badRequestError は、UpdateUserFunc の中で見つかったリクエストの誤り
+type badRequestError struct {
+	message string
+}
+
+func (e *badRequestError) Error() string {
+	return e.message
+}
+
+// handleReplaceUser ハンドラーの実装（PUT /users/{id}）
+func (um *UserManager) handleReplaceUser(w http.ResponseWriter, r *http.Request) {
+	// 1. URLパスからIDを抽出
+	id, err := userIDFromPath(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// 2. レスポンスの形式を決め、リクエストボディをUserに変換して検証する
+	media, ok := negotiateUser(w, r)
+	if !ok {
+		return
+	}
+	user, ok := decodeUser(w, r)
+	if !ok {
+		return
+	}
+	// ボディの ID はパスの ID と一致するか省略されていること
+	if user.ID != 0 && user.ID != id {
+		writeError(w, http.StatusBadRequest, "User ID in body does not match URL")
+		return
+	}
+
+	// 3. If-Match を確認してユーザーを置き換えて返す
+	updated, err := um.UpdateUserFunc(id, func(current User) (User, error) {
+		if err := checkIfMatch(r, current); err != nil {
+			return User{}, err
+		}
+		return user, nil
+	})
+	if err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
+	writeUser(w, media, http.StatusOK, updated)
+}
+
+// handlePatchUser ハンドラーの実装（PATCH /users/{id}、RFC 7396 JSON Merge Patch）
+func (um *UserManager) handlePatchUser(w http.ResponseWriter, r *http.Request) {
+	// 1. URLパスからIDを抽出
+	id, err := userIDFromPath(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// 2. レスポンスの形式を決める
+	media, ok := negotiateUser(w, r)
+	if !ok {
+		return
+	}
+
+	// 3. Content-Type は application/merge-patch+json（application/json も受け付ける）
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+			w.Header().Set("Accept-Patch", "application/merge-patch+json")
+			writeError(w, http.StatusUnsupportedMediaType, "Unsupported patch format")
+			return
+		}
+	}
+
+	// 4. パッチを読み取る
+	body, ok := readLimitedBody(w, r, maxUserBodyBytes)
+	if !ok {
+		return
+	}
+	var patch any
+	if err := json.Unmarshal(body, &patch); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	// 5. If-Match を確認して現在のユーザーにパッチを適用する
+	updated, err := um.UpdateUserFunc(id, func(current User) (User, error) {
+		if err := checkIfMatch(r, current); err != nil {
+			return User{}, err
+		}
+		return applyMergePatch(current, patch)
+	})
+	if err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
+	writeUser(w, media, http.StatusOK, updated)
+}
+
+// handleDeleteUser ハンドラーの実装（DELETE /users/{id}）
+func (um *UserManager) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := userIDFromPath(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if _, err := um.DeleteUserFunc(id, func(current User) error {
+		return checkIfMatch(r, current)
+	}); err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyMergePatch は、ユーザーのJSON表現にパッチを適用した結果を返す
+func applyMergePatch(user User, patch any) (User, error) {
+	// 1. ユーザーを汎用のJSON値に変換する
+	data, err := json.Marshal(user)
+	if err != nil {
+		return User{}, err
+	}
+	var target any
+	if err := json.Unmarshal(data, &target); err != nil {
+		return User{}, err
+	}
+
+	// 2. パッチを適用する（オブジェクト以外のパッチは丸ごと置き換えになる）
+	merged, ok := mergePatch(target, patch).(map[string]any)
+	if !ok {
+		return User{}, &badRequestError{"Merge patch must be a JSON object"}
+	}
+	if id, ok := merged["id"]; ok && id != float64(user.ID) {
+		return User{}, &badRequestError{"User ID cannot be changed"}
+	}
+
+	// 3. Userに戻し、未知のフィールドや値の誤りを検証する
+	data, err = json.Marshal(merged)
+	if err != nil {
+		return User{}, err
+	}
+	return parseUser(data)
+}
+
+// mergePatch は、RFC 7396 の MergePatch(Target, Patch) を実装する
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			// null はメンバーの削除
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// serve は、Routes() 経由でリクエストを処理する
+func serve(manager *UserManager, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	manager.Routes().ServeHTTP(rr, req)
+	return rr
+}
+
+func newTestManager() *UserManager {
+	manager := &UserManager{}
+	manager.AddUser(User{ID: 1, Name: "Alice", Email: "alice@example.com"})
+	manager.AddUser(User{ID: 2, Name: "Bob", Email: "bob@example.com"})
+	return manager
+}
+
+func TestRoutesGetUser(t *testing.T) {
+	manager := newTestManager()
+
+	// /users/{id} もルーティングされる
+	rr := serve(manager, "GET", "/users/2", "", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var user User
+	json.Unmarshal(rr.Body.Bytes(), &user)
+	if user.Name != "Bob" {
+		t.Errorf("Expected Bob, got %s", user.Name)
+	}
+
+	rr = serve(manager, "GET", "/users", "", nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	rr = serve(manager, "POST", "/users/2", "{}", nil)
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") == "" {
+		t.Errorf("Expected 405 with Allow header, got %d %q", rr.Code, rr.Header().Get("Allow"))
+	}
+}
+
+func TestReplaceUser(t *testing.T) {
+	manager := newTestManager()
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"replace", "/users/1", `{"name":"Alicia","email":"alicia@example.com"}`, http.StatusOK},
+		{"matching id", "/users/1", `{"id":1,"name":"Alicia","email":"alicia@example.com"}`, http.StatusOK},
+		{"mismatched id", "/users/1", `{"id":2,"name":"Alicia","email":"alicia@example.com"}`, http.StatusBadRequest},
+		{"not found", "/users/99", `{"name":"X","email":"x@example.com"}`, http.StatusNotFound},
+		{"email taken", "/users/1", `{"name":"Alicia","email":"bob@example.com"}`, http.StatusConflict},
+		{"invalid json", "/users/1", `{`, http.StatusBadRequest},
+		{"invalid id", "/users/abc", `{}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(manager, "PUT", tt.path, tt.body, nil)
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	user, _ := manager.GetUser(1)
+	if user.Name != "Alicia" || user.Email != "alicia@example.com" {
+		t.Errorf("Expected replaced user, got %+v", user)
+	}
+	// 古いメールアドレスは再び使える
+	if _, err := manager.AddUser(User{Name: "New", Email: "alice@example.com"}); err != nil {
+		t.Errorf("Expected old email to be free, got %v", err)
+	}
+}
+
+func TestPatchUser(t *testing.T) {
+	manager := newTestManager()
+
+	rr := serve(manager, "PATCH", "/users/1", `{"name":"Alicia"}`,
+		map[string]string{"Content-Type": "application/merge-patch+json"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var user User
+	json.Unmarshal(rr.Body.Bytes(), &user)
+	if user != (User{ID: 1, Name: "Alicia", Email: "alice@example.com"}) {
+		t.Errorf("Unexpected patched user %+v", user)
+	}
+
+	// null はフィールドの削除だが、メールアドレスは必須なので検証エラーになる
+	rr = serve(manager, "PATCH", "/users/1", `{"email":null}`, nil)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+	}
+	if user, _ := manager.GetUser(1); user.Email != "alice@example.com" {
+		t.Errorf("Expected email to be kept, got %+v", user)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{"not found", "/users/99", `{"name":"X"}`, nil, http.StatusNotFound},
+		{"email taken", "/users/1", `{"email":"bob@example.com"}`, nil, http.StatusConflict},
+		{"change id", "/users/1", `{"id":5}`, nil, http.StatusBadRequest},
+		{"wrong type", "/users/1", `{"name":5}`, nil, http.StatusUnprocessableEntity},
+		{"unknown field", "/users/1", `{"age":30}`, nil, http.StatusUnprocessableEntity},
+		{"invalid email", "/users/1", `{"email":"alice"}`, nil, http.StatusUnprocessableEntity},
+		{"not an object", "/users/1", `["name"]`, nil, http.StatusBadRequest},
+		{"invalid json", "/users/1", `{`, nil, http.StatusBadRequest},
+		{"unsupported type", "/users/1", `{}`, map[string]string{"Content-Type": "text/plain"}, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(manager, "PATCH", tt.path, tt.body, tt.headers)
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	manager := newTestManager()
+
+	rr := serve(manager, "DELETE", "/users/1", "", nil)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if _, found := manager.GetUser(1); found {
+		t.Error("Expected user 1 to be deleted")
+	}
+	// 残りのユーザーは引き続き取得できる
+	if user, found := manager.GetUser(2); !found || user.Name != "Bob" {
+		t.Errorf("Expected Bob to remain, got %+v %v", user, found)
+	}
+
+	rr = serve(manager, "DELETE", "/users/1", "", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestMergePatchRFC7396(t *testing.T) {
+	// RFC 7396 Appendix A のテストケース
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		var target, patch, want any
+		json.Unmarshal([]byte(tt.target), &target)
+		json.Unmarshal([]byte(tt.patch), &patch)
+		json.Unmarshal([]byte(tt.want), &want)
+		if got := mergePatch(target, patch); !reflect.DeepEqual(got, want) {
+			t.Errorf("mergePatch(%s, %s) = %v, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
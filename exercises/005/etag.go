@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrPreconditionFailed は、If-Match の条件を満たさないときのエラー
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// computeETag は、レスポンスの内容から強い ETag を作る
+// ボディ以外にレスポンスを変える値（総数や次のページなど）があれば parts に渡す
+func computeETag(body []byte, parts ...string) string {
+	h := sha256.New()
+	h.Write(body)
+	for _, p := range parts {
+		h.Write([]byte{0})
+		h.Write([]byte(p))
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// userETag は、ユーザーの media の形式の表現の ETag を返す
+func userETag(media string, user User) string {
+	data, _ := encodeUser(media, user)
+	return computeETag(data)
+}
+
+// etagMatches は、If-Match / If-None-Match の値に etag が含まれるかを返す
+// weak が false なら強い比較（W/ 付きの ETag は一致しない）、true なら弱い比較
+func etagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCacheable は、ETag を付けてボディを返す
+// If-None-Match が一致すればボディを送らずに 304 Not Modified を返す
+func writeCacheable(w http.ResponseWriter, r *http.Request, etag string, body []byte) {
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag, true) {
+		// 304 では表現を説明するヘッダーを送らない
+		for _, h := range []string{"Content-Type", "Content-Length", "X-Total-Count"} {
+			w.Header().Del(h)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(body)
+}
+
+// checkIfMatch は、If-Match があれば現在のユーザーの ETag と強い比較をする
+// どの形式で取得した ETag でもよい
+// UpdateUserFunc / DeleteUserFunc の中で呼ぶので、比較と更新の間に他の更新は割り込まない
+func checkIfMatch(r *http.Request, current User) error {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return nil
+	}
+	for _, media := range userMediaTypes {
+		if etagMatches(ifMatch, userETag(media, current), false) {
+			return nil
+		}
+	}
+	return ErrPreconditionFailed
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		weak   bool
+		want   bool
+	}{
+		{`"abc"`, false, true},
+		{`"x", "abc"`, false, true},
+		{`*`, false, true},
+		{`"x"`, true, false},
+		{`W/"abc"`, false, false},
+		{`W/"abc"`, true, true},
+		{`"ab"`, true, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `"abc"`, tt.weak); got != tt.want {
+			t.Errorf("etagMatches(%q, weak=%v) = %v, want %v", tt.header, tt.weak, got, tt.want)
+		}
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	manager := newTestManager()
+
+	for _, path := range []string{"/users/1", "/users", "/users?limit=1"} {
+		rr := serve(manager, "GET", path, "", nil)
+		etag := rr.Header().Get("ETag")
+		if rr.Code != http.StatusOK || len(etag) < 3 || etag[0] != '"' {
+			t.Fatalf("GET %s = %d, ETag %q", path, rr.Code, etag)
+		}
+
+		// 同じ表現なら 304 でボディを送らない
+		for _, inm := range []string{etag, `"other", ` + etag, "W/" + etag, "*"} {
+			rr = serve(manager, "GET", path, "", map[string]string{"If-None-Match": inm})
+			if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 || rr.Header().Get("ETag") != etag {
+				t.Errorf("GET %s If-None-Match %s = %d, body %q", path, inm, rr.Code, rr.Body.String())
+			}
+		}
+		rr = serve(manager, "GET", path, "", map[string]string{"If-None-Match": `"stale"`})
+		if rr.Code != http.StatusOK {
+			t.Errorf("GET %s with stale ETag = %d", path, rr.Code)
+		}
+	}
+
+	// 変更すると一覧と個別のユーザーの ETag が変わる
+	before1 := serve(manager, "GET", "/users/1", "", nil).Header().Get("ETag")
+	beforeAll := serve(manager, "GET", "/users", "", nil).Header().Get("ETag")
+	beforePage := serve(manager, "GET", "/users?limit=1", "", nil).Header().Get("ETag")
+	manager.UpdateUser(1, User{Name: "Alicia", Email: "alice@example.com"})
+	if serve(manager, "GET", "/users/1", "", nil).Header().Get("ETag") == before1 {
+		t.Error("Expected user ETag to change after update")
+	}
+	if serve(manager, "GET", "/users", "", nil).Header().Get("ETag") == beforeAll {
+		t.Error("Expected list ETag to change after update")
+	}
+	// ページの中身が同じでも総数が変われば ETag が変わる
+	manager.UpdateUser(1, User{Name: "Alice", Email: "alice@example.com"})
+	manager.AddUser(User{Name: "Carol", Email: "carol@example.com"})
+	if serve(manager, "GET", "/users?limit=1", "", nil).Header().Get("ETag") == beforePage {
+		t.Error("Expected page ETag to change when total changes")
+	}
+}
+
+func TestConditionalUpdate(t *testing.T) {
+	manager := newTestManager()
+	etag := serve(manager, "GET", "/users/1", "", nil).Header().Get("ETag")
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		ifMatch string
+		status  int
+	}{
+		{"put stale", "PUT", "/users/1", `{"name":"A","email":"a@example.com"}`, `"stale"`, http.StatusPreconditionFailed},
+		{"patch stale", "PATCH", "/users/1", `{"name":"A"}`, `"stale"`, http.StatusPreconditionFailed},
+		{"delete stale", "DELETE", "/users/1", ``, `"stale"`, http.StatusPreconditionFailed},
+		{"weak never matches", "PATCH", "/users/1", `{"name":"A"}`, "W/" + etag, http.StatusPreconditionFailed},
+		{"missing user", "PATCH", "/users/99", `{"name":"A"}`, "*", http.StatusPreconditionFailed},
+		{"patch current", "PATCH", "/users/1", `{"name":"Alicia"}`, etag, http.StatusOK},
+		// 更新で ETag が変わったので、同じ ETag ではもう更新できない
+		{"lost update", "PUT", "/users/1", `{"name":"A","email":"a@example.com"}`, etag, http.StatusPreconditionFailed},
+		{"any", "PATCH", "/users/2", `{"name":"Robert"}`, "*", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(manager, tt.method, tt.path, tt.body, map[string]string{"If-Match": tt.ifMatch})
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	if u, _ := manager.GetUser(1); u.Name != "Alicia" {
+		t.Errorf("Expected only the matching update to apply, got %+v", u)
+	}
+
+	// 更新のレスポンスの ETag で続けて削除できる
+	rr := serve(manager, "PATCH", "/users/1", `{"name":"Al"}`, nil)
+	rr = serve(manager, "DELETE", "/users/1", "", map[string]string{"If-Match": rr.Header().Get("ETag")})
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected delete with fresh ETag to succeed, got %d", rr.Code)
+	}
+}
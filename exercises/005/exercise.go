@@ -1,12 +1,16 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 )
 
 /*
@@ -29,15 +33,36 @@ Exercise 005: HTTP API とJSON処理
    - handleGetUsers: GET /users - 全ユーザーをJSONで返す
    - handleGetUser: GET /users/{id} - 指定IDのユーザーをJSON で返す
    - handleCreateUser: POST /users - JSONからユーザーを作成
+   - handleReplaceUser: PUT /users/{id} - ユーザーを置き換える
+   - handlePatchUser: PATCH /users/{id} - JSON Merge Patch (RFC 7396) で部分更新する
+   - handleDeleteUser: DELETE /users/{id} - ユーザーを削除する
 
 4. StartServer 関数を実装する
    - ポート8080でHTTPサーバーを起動
    - 上記のハンドラーを登録
+   - Server 型でアドレス・タイムアウトを設定し、Shutdown で処理中のリクエストを待って停止する
+
+5. OpenUserManager でファイルに永続化する
+   - 変更は全てチェックサム付きの write-ahead log に追記してから反映する
+   - 定期的にJSONのスナップショットにまとめ、起動時にスナップショット → ログの順に再生する
 
 期待される動作:
 - GET /users → 全ユーザーのJSONリストを返す
+- GET /users?limit=50&sort=-id&q=alice → 検索・並べ替えした結果を50件ずつ返す
+  （続きのページは Link ヘッダーの rel="next"、総数は X-Total-Count ヘッダー）
 - GET /users/1 → ID=1のユーザーのJSONを返す
 - POST /users → リクエストボディのJSONからユーザーを作成
+- PUT /users/1 → ID=1のユーザーを置き換える
+- PATCH /users/1 → ID=1のユーザーの指定したフィールドだけを更新する
+- DELETE /users/1 → ID=1のユーザーを削除する（204 No Content）
+- GET のレスポンスには ETag が付き、If-None-Match が一致すれば 304 Not Modified を返す
+- PUT / PATCH / DELETE は If-Match が現在の ETag と一致しなければ 412 Precondition Failed を返す
+- Accept で JSON / CSV / XML / NDJSON を選べる（対応していなければ 406）
+  POST /users は Content-Type で同じ形式を受け付ける
+- POST /users:batch → NDJSON を1行ずつ追加し、行ごとの結果を返す（?atomic=true なら失敗時に全て取り消す）
+- GET /openapi.json → ルートの定義と User の json タグから生成した OpenAPI 3.1 ドキュメントを返す
+- 不正な入力は application/problem+json (RFC 7807) で返す
+  （未知のフィールド・型の誤り・必須項目の欠落は 422 で、不正なフィールドを全て列挙する）
 */
 
 func main() {
@@ -53,68 +78,327 @@ func main() {
 	fmt.Println("  GET  http://localhost:8080/users")
 	fmt.Println("  GET  http://localhost:8080/users/1")
 	fmt.Println("  POST http://localhost:8080/users")
+	fmt.Println("  PUT    http://localhost:8080/users/1")
+	fmt.Println("  PATCH  http://localhost:8080/users/1")
+	fmt.Println("  DELETE http://localhost:8080/users/1")
+	fmt.Println("  GET    http://localhost:8080/openapi.json")
 	
 	// サーバーを起動（このコメントアウトを外すと実際にサーバーが起動します）
-	// StartServer(manager)
+	// if err := StartServer(manager); err != nil {
+	// 	fmt.Println("サーバーエラー:", err)
+	// }
 }
 
 // User 構造体の定義
 type User struct {
-    ID    int    `json:"id"`
-    Name  string `json:"name"`
-    Email string `json:"email"`
+    ID    int    `json:"id" xml:"id"`
+    Name  string `json:"name" xml:"name"`
+    Email string `json:"email" xml:"email"`
 }
 
 // UserManager 構造体の定義
+// 複数のゴルーチンから同時に使っても安全（ゼロ値のまま使える）
 type UserManager struct {
-    users []User // ユーザーのスライス
+	mu      sync.RWMutex
+	users   []User         // ユーザーのスライス（追加した順）
+	byID    map[int]int    // ID → users のインデックス
+	byEmail map[string]int // 正規化したメールアドレス → ID
+	nextID  int            // 次に割り当てる ID
+	store   *userStore     // 変更を記録するファイル（nil ならメモリ上だけ、OpenUserManager を参照）
+}
+
+var (
+	// ErrIDTaken は、指定された ID が既に使われているときのエラー
+	ErrIDTaken = errors.New("user ID is already taken")
+	// ErrEmailTaken は、指定されたメールアドレスが既に使われているときのエラー
+	ErrEmailTaken = errors.New("email is already taken")
+)
+
+// normalizeEmail は、重複チェック用にメールアドレスを正規化する
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 // AddUser メソッドの実装
-func (um *UserManager) AddUser(user User) {
+// user.ID が 0 のときはサーバー側で ID を割り当てる
+// ID またはメールアドレスが既に使われているときは ErrIDTaken / ErrEmailTaken を返す
+func (um *UserManager) AddUser(user User) (User, error) {
+	added, conflicts, err := um.AddUsers([]User{user})
+	if err != nil {
+		return User{}, err
+	}
+	if conflicts != nil {
+		return User{}, conflicts[0]
+	}
+	return added[0], nil
+}
+
+// AddUsers は、users を全て追加するか、1人も追加しない
+// ID またはメールアドレスが既に使われている（users の中で重複するものも含む）ユーザーがいれば、
+// その位置に ErrIDTaken / ErrEmailTaken を入れた conflicts を返して何も追加しない
+// 確認と追加を1回のロックの中で行うので、他のリクエストから追加の途中が見えることはない
+func (um *UserManager) AddUsers(users []User) (added []User, conflicts []error, err error) {
+	return um.addUsers(users, true)
+}
+
+// addUsers は、AddUsers の本体（commit が false なら重複を調べるだけで追加しない）
+func (um *UserManager) addUsers(users []User, commit bool) ([]User, []error, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if um.byID == nil {
+		um.byID = map[int]int{}
+		um.byEmail = map[string]int{}
+	}
+	if um.nextID < 1 {
+		um.nextID = 1
+	}
+
+	// 1. 1人ずつ追加したときと同じ順に、重複をチェックして ID を割り当てる（使われている ID は飛ばす）
+	added := make([]User, len(users))
+	var conflicts []error
+	ids, emails := map[int]bool{}, map[string]bool{}
+	used := func(id int) bool {
+		_, ok := um.byID[id]
+		return ok || ids[id]
+	}
+	nextID := um.nextID
+	for i, user := range users {
+		email := normalizeEmail(user.Email)
+		var conflict error
+		if user.ID != 0 && used(user.ID) {
+			conflict = ErrIDTaken
+		} else if _, ok := um.byEmail[email]; email != "" && (ok || emails[email]) {
+			conflict = ErrEmailTaken
+		}
+		if conflict != nil {
+			if conflicts == nil {
+				conflicts = make([]error, len(users))
+			}
+			conflicts[i] = conflict
+			continue
+		}
+
+		if user.ID == 0 {
+			user.ID = nextID
+			for used(user.ID) {
+				user.ID++
+			}
+		}
+		if user.ID >= nextID {
+			nextID = user.ID + 1
+		}
+		ids[user.ID] = true
+		if email != "" {
+			emails[email] = true
+		}
+		added[i] = user
+	}
+	if conflicts != nil || !commit {
+		return nil, conflicts, nil
+	}
+
+	// 2. 1人ずつログに記録して追加する（途中で失敗したら、追加した分を削除して元に戻す）
+	for i, user := range added {
+		if err := um.insertLocked(user); err != nil {
+			for range i {
+				if rerr := um.deleteLocked(len(um.users) - 1); rerr != nil {
+					return nil, nil, errors.Join(err, rerr)
+				}
+			}
+			return nil, nil, err
+		}
+	}
+	um.afterCommit()
+	return added, nil, nil
+}
+
+// insertLocked は、ID を割り当て済みのユーザーをログに記録してから追加する（um.mu を保持して呼ぶ）
+func (um *UserManager) insertLocked(user User) error {
+	if err := um.logRecord(walRecord{Op: opPut, User: &user}); err != nil {
+		return err
+	}
+	if user.ID >= um.nextID {
+		um.nextID = user.ID + 1
+	}
+	um.byID[user.ID] = len(um.users)
+	if email := normalizeEmail(user.Email); email != "" {
+		um.byEmail[email] = user.ID
+	}
 	um.users = append(um.users, user)
+	return nil
 }
 
 // GetUser メソッドの実装
 func (um *UserManager) GetUser(id int) (User, bool) {
-	for _, user := range um.users {
-		if user.ID == id {
-			return user, true
-		}
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+
+	i, ok := um.byID[id]
+	if !ok {
+		return User{}, false
 	}
-	return User{}, false
+	return um.users[i], true
 }
 
 // GetAllUsers メソッドの実装
 func (um *UserManager) GetAllUsers() []User {
-	// TODO: 実装する
-	return um.users
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+
+	// 呼び出し側が書き換えても影響しないようにコピーを返す
+	users := make([]User, len(um.users))
+	copy(users, um.users)
+	return users
+}
+
+// ErrUserNotFound は、指定された ID のユーザーが存在しないときのエラー
+var ErrUserNotFound = errors.New("user not found")
+
+// UpdateUserFunc メソッドの実装
+// ロックを保持したまま fn で現在のユーザーを更新するので、読み取りと書き込みの間に他の更新が割り込まない
+// fn が返したユーザーの ID は id に固定される
+func (um *UserManager) UpdateUserFunc(id int, fn func(current User) (User, error)) (User, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	i, ok := um.byID[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	current := um.users[i]
+	updated, err := fn(current)
+	if err != nil {
+		return User{}, err
+	}
+	updated.ID = id
+
+	// メールアドレスが変わる場合は他のユーザーと重複しないか確認する
+	oldEmail, newEmail := normalizeEmail(current.Email), normalizeEmail(updated.Email)
+	if owner, ok := um.byEmail[newEmail]; ok && newEmail != oldEmail && newEmail != "" && owner != id {
+		return User{}, ErrEmailTaken
+	}
+
+	// ログに記録してから反映する
+	if err := um.logRecord(walRecord{Op: opPut, User: &updated}); err != nil {
+		return User{}, err
+	}
+	defer um.afterCommit()
+	if newEmail != oldEmail {
+		delete(um.byEmail, oldEmail)
+		if newEmail != "" {
+			um.byEmail[newEmail] = id
+		}
+	}
+	um.users[i] = updated
+	return updated, nil
+}
+
+// UpdateUser メソッドの実装
+// 指定した ID のユーザーを user で置き換える
+func (um *UserManager) UpdateUser(id int, user User) (User, error) {
+	return um.UpdateUserFunc(id, func(User) (User, error) {
+		return user, nil
+	})
+}
+
+// DeleteUser メソッドの実装
+func (um *UserManager) DeleteUser(id int) (User, error) {
+	return um.DeleteUserFunc(id, nil)
+}
+
+// DeleteUserFunc メソッドの実装
+// ロックを保持したまま fn で現在のユーザーを確認し、nil を返したときだけ削除する（fn が nil なら常に削除する）
+func (um *UserManager) DeleteUserFunc(id int, fn func(current User) error) (User, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	i, ok := um.byID[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	user := um.users[i]
+	if fn != nil {
+		if err := fn(user); err != nil {
+			return User{}, err
+		}
+	}
+	if err := um.deleteLocked(i); err != nil {
+		return User{}, err
+	}
+	um.afterCommit()
+	return user, nil
+}
+
+// deleteLocked は、users の i 番目のユーザーをログに記録してから削除する（um.mu を保持して呼ぶ）
+func (um *UserManager) deleteLocked(i int) error {
+	user := um.users[i]
+	if err := um.logRecord(walRecord{Op: opDelete, ID: user.ID}); err != nil {
+		return err
+	}
+
+	// スライスから取り除き、後ろのユーザーのインデックスを詰める
+	um.users = append(um.users[:i], um.users[i+1:]...)
+	for j := i; j < len(um.users); j++ {
+		um.byID[um.users[j].ID] = j
+	}
+	delete(um.byID, user.ID)
+	delete(um.byEmail, normalizeEmail(user.Email))
+	return nil
+}
+
+// writeError は、エラーを RFC 7807 の problem details で返す
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeProblem(w, Problem{Status: status, Detail: message})
 }
 
 // handleGetUsers ハンドラーの実装
+// ?limit=, ?cursor=, ?sort=name|-id|email, ?q= でページング・並べ替え・検索ができる
 func (um *UserManager) handleGetUsers(w http.ResponseWriter, r *http.Request) {
-	// 1. Content-Type を application/json に設定
-	w.Header().Set("Content-Type", "application/json")
-	// 2. um.GetAllUsers() で全ユーザーを取得
-	users := um.GetAllUsers()
-	// 3. json.Marshal() でJSONに変換
-	jsonData, err := json.Marshal(users)
+	// 0. Accept ヘッダーからレスポンスの形式を決める
+	media, ok := negotiateUser(w, r)
+	if !ok {
+		return
+	}
+	// 1. クエリパラメーターを読み取る
+	opts, err := parseListOptions(r.URL.Query())
 	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	// 4. w.Write() でレスポンスを送信
-	w.Write(jsonData)
+	// 2. um.ListUsers() で条件に合うユーザーを1ページ分取得
+	page, err := um.ListUsers(opts)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// 3. 選んだ形式に変換
+	data, err := encodeUsers(media, page.Users)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	// 4. ヘッダーを設定してレスポンスを送信（If-None-Match が一致すれば 304）
+	total, links := strconv.Itoa(page.Total), pageLinks(r, opts, page.Next)
+	w.Header().Set("Content-Type", contentTypes[media])
+	w.Header().Set("X-Total-Count", total)
+	w.Header().Set("Link", links)
+	writeCacheable(w, r, computeETag(data, total, links), data)
 }
 
 // handleGetUser ハンドラーの実装
 func (um *UserManager) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	// 0. Accept ヘッダーからレスポンスの形式を決める（404 も Vary: Accept を付けて返す）
+	media, ok := negotiateUser(w, r)
+	if !ok {
+		return
+	}
 	// 1. URLパスからIDを抽出 (/users/123 → "123")
 	path := strings.TrimPrefix(r.URL.Path, "/users/")
 	// 2. strconv.Atoi() で文字列を数値に変換
 	id, err := strconv.Atoi(path)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 	
@@ -123,69 +407,103 @@ func (um *UserManager) handleGetUser(w http.ResponseWriter, r *http.Request) {
 
 	// 4. 見つからない場合は404エラーを返す
 	if !found {
-		http.Error(w, "User not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "User not found")
 		return
 	}
 	
-	// 5. 見つかった場合はJSONで返す
-	w.Header().Set("Content-Type", "application/json")
-	jsonData, err := json.Marshal(user)
+	// 5. 見つかった場合は Accept の形式で返す（If-None-Match が一致すれば 304）
+	data, err := encodeUser(media, user)
 	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Internal Server Error")
 		return
 	}
-	w.Write(jsonData)
+	w.Header().Set("Content-Type", contentTypes[media])
+	writeCacheable(w, r, computeETag(data), data)
 }
 
 // handleCreateUser ハンドラーの実装
 func (um *UserManager) handleCreateUser(w http.ResponseWriter, r *http.Request) {
-	// 1. リクエストボディを読み取る
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+	// 1. レスポンスの形式を Accept から、リクエストの形式を Content-Type から決める
+	media, ok := negotiateUser(w, r)
+	if !ok {
 		return
 	}
-	
-	// 2. json.Unmarshal() でUserに変換
-	var user User
-	err = json.Unmarshal(body, &user)
-	if err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	parse, ok := userParser(r.Header.Get("Content-Type"))
+	if !ok {
+		w.Header().Set("Accept-Post", strings.Join(userMediaTypes, ", "))
+		writeError(w, http.StatusUnsupportedMediaType, "Supported media types: "+strings.Join(userMediaTypes, ", "))
+		return
+	}
+
+	// 2. リクエストボディを読み取り、Userに変換して検証する
+	user, ok := decodeUserWith(w, r, parse)
+	if !ok {
 		return
 	}
 	
-	// 3. um.AddUser() でユーザーを追加
-	um.AddUser(user)
-	
-	// 4. 作成されたユーザーをJSONで返す
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	jsonData, err := json.Marshal(user)
+	// 3. um.AddUser() でユーザーを追加（ID が 0 ならサーバーが割り当てる）
+	created, err := um.AddUser(user)
+	if errors.Is(err, ErrIDTaken) || errors.Is(err, ErrEmailTaken) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Internal Server Error")
 		return
 	}
-	w.Write(jsonData)
+	
+	// 4. 作成されたユーザーを返す
+	writeUser(w, media, http.StatusCreated, created)
 }
 
-// StartServer 関数の実装
-func StartServer(manager *UserManager) {
-	// 1. http.HandleFunc() でルートを登録
-	http.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case "GET":
-			if r.URL.Path == "/users" {
-				manager.handleGetUsers(w, r)
-			} else {
-				manager.handleGetUser(w, r)
-			}
-		case "POST":
-			manager.handleCreateUser(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// Routes メソッドの実装
+// /users, /users/{id}, /users:batch, /openapi.json のハンドラーを登録した ServeMux を返す
+func (um *UserManager) Routes() *http.ServeMux {
+	// 操作の表はリクエストごとではなく、ここで一度だけ作る
+	routes := newRouteTable(apiRoutes())
+	handle := func(path string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			routes.dispatch(um, path, w, r)
 		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users", handle("/users"))
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		routes.dispatch(um, usersPathTemplate(r.URL.Path), w, r)
 	})
-	
-	// 2. http.ListenAndServe() でサーバーを起動
-	http.ListenAndServe(":8080", nil)
-}
\ No newline at end of file
+	mux.HandleFunc("/users:batch", handle("/users:batch"))
+	mux.HandleFunc("/openapi.json", handle("/openapi.json"))
+	return mux
+}
+
+// usersPathTemplate は、/users/ 以下のパスに対応する apiRoutes のパステンプレートを返す
+func usersPathTemplate(path string) string {
+	// /users/ は一覧、それ以外の /users/{id} は個別のユーザー
+	if path == "/users/" {
+		return "/users"
+	}
+	return "/users/{id}"
+}
+
+// StartServer 関数の実装
+// DefaultServerConfig でサーバーを起動し、SIGINT / SIGTERM を受け取ると処理中のリクエストを待って停止する
+func StartServer(manager *UserManager) error {
+	// 1. 専用の ServeMux を持つサーバーを起動
+	server := NewServer(manager, DefaultServerConfig)
+	if err := server.Start(); err != nil {
+		return err
+	}
+
+	// 2. シグナルを受け取るか、サーバーが異常終了するまで待つ
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case <-ctx.Done():
+	case <-server.Done():
+	}
+
+	// 3. 処理中のリクエストを待って停止
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
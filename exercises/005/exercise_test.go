@@ -3,8 +3,12 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -192,4 +196,113 @@ func TestHandleCreateUser(t *testing.T) {
 	if foundUser.Name != "Charlie" {
 		t.Errorf("Expected Charlie, got %s", foundUser.Name)
 	}
-}
\ No newline at end of file
+}
+
+func TestUserManagerAssignsIDs(t *testing.T) {
+	manager := &UserManager{}
+
+	alice, err := manager.AddUser(User{Name: "Alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	if alice.ID != 1 {
+		t.Errorf("Expected ID 1, got %d", alice.ID)
+	}
+
+	// 明示的な ID も空いていれば使える
+	if _, err := manager.AddUser(User{ID: 5, Name: "Eve", Email: "eve@example.com"}); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	bob, _ := manager.AddUser(User{Name: "Bob", Email: "bob@example.com"})
+	if bob.ID != 6 {
+		t.Errorf("Expected ID 6 after explicit ID 5, got %d", bob.ID)
+	}
+
+	// 重複は拒否される（メールアドレスは大文字小文字を区別しない）
+	if _, err := manager.AddUser(User{ID: 5, Name: "X", Email: "x@example.com"}); !errors.Is(err, ErrIDTaken) {
+		t.Errorf("Expected ErrIDTaken, got %v", err)
+	}
+	if _, err := manager.AddUser(User{Name: "Y", Email: "ALICE@example.com"}); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken, got %v", err)
+	}
+	if len(manager.GetAllUsers()) != 3 {
+		t.Errorf("Expected 3 users, got %d", len(manager.GetAllUsers()))
+	}
+}
+
+func TestUserManagerConcurrent(t *testing.T) {
+	manager := &UserManager{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user, err := manager.AddUser(User{Name: "User", Email: fmt.Sprintf("user%d@example.com", i)})
+			if err != nil {
+				t.Errorf("AddUser failed: %v", err)
+				return
+			}
+			if _, found := manager.GetUser(user.ID); !found {
+				t.Errorf("User %d not found", user.ID)
+			}
+			manager.GetAllUsers()
+		}(i)
+	}
+	wg.Wait()
+
+	// ID は重複せずに割り当てられる
+	seen := map[int]bool{}
+	for _, user := range manager.GetAllUsers() {
+		if seen[user.ID] {
+			t.Errorf("Duplicate ID %d", user.ID)
+		}
+		seen[user.ID] = true
+	}
+	if len(seen) != 100 {
+		t.Errorf("Expected 100 users, got %d", len(seen))
+	}
+}
+
+func TestHandleCreateUserConflict(t *testing.T) {
+	manager := &UserManager{}
+	manager.AddUser(User{ID: 1, Name: "Alice", Email: "alice@example.com"})
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"id":1,"name":"Other","email":"other@example.com"}`, ErrIDTaken.Error()},
+		{`{"name":"Alice2","email":"alice@example.com"}`, ErrEmailTaken.Error()},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/users", strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		manager.handleCreateUser(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("Expected status %d, got %d", http.StatusConflict, rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("Expected Content-Type application/problem+json, got %s", ct)
+		}
+		var problem Problem
+		if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("Failed to unmarshal error body: %v", err)
+		}
+		if problem.Status != http.StatusConflict || problem.Detail != tt.want {
+			t.Errorf("Expected detail %q, got %+v", tt.want, problem)
+		}
+	}
+
+	// ID を省略するとサーバーが割り当てる
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"name":"Bob","email":"bob@example.com"}`))
+	rr := httptest.NewRecorder()
+	manager.handleCreateUser(rr, req)
+	var created User
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if rr.Code != http.StatusCreated || created.ID != 2 {
+		t.Errorf("Expected 201 with ID 2, got %d with ID %d", rr.Code, created.ID)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ユーザーを表現できるメディアタイプ
+const (
+	mediaJSON   = "application/json"
+	mediaCSV    = "text/csv"
+	mediaXML    = "application/xml"
+	mediaNDJSON = "application/x-ndjson"
+)
+
+// userMediaTypes は、ユーザーのエンドポイントが扱うメディアタイプ（先頭が既定値）
+var userMediaTypes = []string{mediaJSON, mediaCSV, mediaXML, mediaNDJSON}
+
+// mediaAliases は、同じ形式を表す別名
+var mediaAliases = map[string]string{
+	"text/xml":           mediaXML,
+	"application/ndjson": mediaNDJSON,
+	"application/jsonl":  mediaNDJSON,
+}
+
+// contentTypes は、レスポンスに付ける Content-Type
+var contentTypes = map[string]string{
+	mediaJSON:   "application/json",
+	mediaCSV:    "text/csv; charset=utf-8",
+	mediaXML:    "application/xml; charset=utf-8",
+	mediaNDJSON: "application/x-ndjson",
+}
+
+// csvHeader は、CSV の列（User の json タグと同じ名前）
+var csvHeader = []string{"id", "name", "email"}
+
+// negotiate は、Accept ヘッダーから offers のうち最も好まれるメディアタイプを選ぶ
+// Accept がなければ offers の先頭を返す。どれも受け入れられなければ false を返す
+func negotiate(accept string, offers []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		// offer に一致する最も具体的な範囲の q 値を使う
+		q, specificity := 0.0, -1
+		for _, part := range strings.Split(accept, ",") {
+			mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			if alias, ok := mediaAliases[mediaRange]; ok {
+				mediaRange = alias
+			}
+			s := rangeSpecificity(mediaRange, offer)
+			if s <= specificity {
+				continue
+			}
+			specificity, q = s, 1.0
+			if v, ok := params["q"]; ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+					q = f
+				} else {
+					q = 0
+				}
+			}
+		}
+		// 同じ q 値なら offers の順（サーバーの優先順）
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, best != ""
+}
+
+// rangeSpecificity は、メディア範囲が offer に一致するときの具体性（*/*=0, type/*=1, type/subtype=2）を返す
+// 一致しなければ -1 を返す
+func rangeSpecificity(mediaRange, offer string) int {
+	switch {
+	case mediaRange == offer:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+	return -1
+}
+
+// negotiateUser は、レスポンスのメディアタイプを選ぶ
+// 受け入れられる形式がなければ 406 を書き込んで false を返す
+func negotiateUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	w.Header().Add("Vary", "Accept")
+	media, ok := negotiate(r.Header.Get("Accept"), userMediaTypes)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, "Supported media types: "+strings.Join(userMediaTypes, ", "))
+		return "", false
+	}
+	return media, true
+}
+
+// userList は、XML のユーザー一覧のルート要素
+type userList struct {
+	XMLName xml.Name `xml:"users"`
+	Users   []User   `xml:"user"`
+}
+
+// encodeUsers は、ユーザーの一覧を media の形式にする
+func encodeUsers(media string, users []User) ([]byte, error) {
+	var buf bytes.Buffer
+	switch media {
+	case mediaJSON:
+		return json.Marshal(users)
+	case mediaCSV:
+		cw := csv.NewWriter(&buf)
+		cw.Write(csvHeader)
+		for _, u := range users {
+			cw.Write([]string{strconv.Itoa(u.ID), u.Name, u.Email})
+		}
+		cw.Flush()
+		return buf.Bytes(), cw.Error()
+	case mediaXML:
+		buf.WriteString(xml.Header)
+		enc := xml.NewEncoder(&buf)
+		enc.Indent("", "  ")
+		if err := enc.Encode(userList{Users: users}); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	case mediaNDJSON:
+		enc := json.NewEncoder(&buf)
+		for _, u := range users {
+			if err := enc.Encode(u); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported media type %q", media)
+}
+
+// encodeUser は、1人のユーザーを media の形式にする
+func encodeUser(media string, user User) ([]byte, error) {
+	switch media {
+	case mediaJSON:
+		return json.Marshal(user)
+	case mediaXML:
+		var buf bytes.Buffer
+		buf.WriteString(xml.Header)
+		enc := xml.NewEncoder(&buf)
+		enc.Indent("", "  ")
+		if err := enc.EncodeElement(user, xml.StartElement{Name: xml.Name{Local: "user"}}); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	}
+	// CSV と NDJSON は1行の一覧と同じ
+	return encodeUsers(media, []User{user})
+}
+
+// userParser は、Content-Type に対応するリクエストボディの読み取り方を返す
+// Content-Type がなければ JSON として読む
+func userParser(contentType string) (func([]byte) (User, error), bool) {
+	media := mediaJSON
+	if contentType != "" {
+		var err error
+		if media, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, false
+		}
+		if alias, ok := mediaAliases[media]; ok {
+			media = alias
+		}
+	}
+	switch media {
+	case mediaJSON:
+		return parseUser, true
+	case mediaCSV:
+		return parseUserCSV, true
+	case mediaXML:
+		return parseUserXML, true
+	case mediaNDJSON:
+		return parseUserNDJSON, true
+	}
+	return nil, false
+}
+
+// parseUserNDJSON は、1行の NDJSON を User に変換して検証する
+func parseUserNDJSON(data []byte) (User, error) {
+	line := bytes.TrimSpace(data)
+	if bytes.ContainsRune(line, '\n') {
+		return User{}, errors.New("NDJSON body must contain exactly one user")
+	}
+	return parseUser(line)
+}
+
+// parseUserCSV は、ヘッダー行と1行のデータからなる CSV を User に変換して検証する
+func parseUserCSV(data []byte) (User, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return User{}, errors.New("Malformed CSV")
+	}
+	if len(records) != 2 {
+		return User{}, errors.New("CSV body must contain a header row and exactly one user")
+	}
+	fields := make([][2]string, len(records[0]))
+	for i, name := range records[0] {
+		fields[i] = [2]string{strings.TrimSpace(name), records[1][i]}
+	}
+	return userFromFields(fields)
+}
+
+// xmlUser は、XML のユーザー要素（子要素を全て集める）
+type xmlUser struct {
+	XMLName xml.Name
+	Fields  []struct {
+		XMLName xml.Name
+		Value   string `xml:",chardata"`
+	} `xml:",any"`
+}
+
+// parseUserXML は、<user> 要素を User に変換して検証する
+func parseUserXML(data []byte) (User, error) {
+	var doc xmlUser
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return User{}, errors.New("Malformed XML")
+	}
+	if doc.XMLName.Local != "user" {
+		return User{}, errors.New("XML root element must be <user>")
+	}
+	fields := make([][2]string, len(doc.Fields))
+	for i, f := range doc.Fields {
+		fields[i] = [2]string{f.XMLName.Local, f.Value}
+	}
+	return userFromFields(fields)
+}
+
+// userFromFields は、名前と文字列の値の組から User を作って検証する
+// 未知・重複したフィールドや整数でない ID は、validateUser の結果とまとめて返す
+func userFromFields(fields [][2]string) (User, error) {
+	var user User
+	var params []InvalidParam
+	seen := map[string]bool{}
+	for _, f := range fields {
+		name, value := f[0], f[1]
+		pointer := jsonPointer(name)
+		switch {
+		case seen[name]:
+			params = append(params, InvalidParam{Pointer: pointer, Reason: "duplicate field"})
+			continue
+		case !slices.Contains(csvHeader, name):
+			params = append(params, InvalidParam{Pointer: pointer, Reason: "unknown field"})
+			continue
+		}
+		seen[name] = true
+
+		switch name {
+		case "id":
+			if strings.TrimSpace(value) == "" {
+				break
+			}
+			id, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				params = append(params, InvalidParam{Pointer: pointer, Reason: "must be an integer"})
+			}
+			user.ID = id
+		case "name":
+			user.Name = value
+		case "email":
+			user.Email = value
+		}
+	}
+	if params := mergeProblems(params, validateUser(user)); len(params) > 0 {
+		return User{}, &ValidationError{Params: params}
+	}
+	return user, nil
+}
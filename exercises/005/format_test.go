@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+		ok     bool
+	}{
+		{"", mediaJSON, true},
+		{"*/*", mediaJSON, true},
+		{"text/csv", mediaCSV, true},
+		{"text/*", mediaCSV, true},
+		{"text/xml", mediaXML, true},
+		{"application/xml;q=0.5, text/csv;q=0.9", mediaCSV, true},
+		{"application/x-ndjson, application/json", mediaJSON, true},
+		{"*/*;q=0.1, application/xml", mediaXML, true},
+		// より具体的な範囲の q 値が優先される
+		{"application/*, application/json;q=0", mediaXML, true},
+		{"text/html", "", false},
+		{"application/json;q=0", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := negotiate(tt.accept, userMediaTypes)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("negotiate(%q) = %q, %v, want %q, %v", tt.accept, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestGetUsersFormats(t *testing.T) {
+	manager := newTestManager()
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"text/csv", "text/csv; charset=utf-8", "id,name,email\n1,Alice,alice@example.com\n2,Bob,bob@example.com\n"},
+		{"application/x-ndjson", "application/x-ndjson",
+			`{"id":1,"name":"Alice","email":"alice@example.com"}` + "\n" + `{"id":2,"name":"Bob","email":"bob@example.com"}` + "\n"},
+		{"application/json", "application/json",
+			`[{"id":1,"name":"Alice","email":"alice@example.com"},{"id":2,"name":"Bob","email":"bob@example.com"}]`},
+	}
+	for _, tt := range tests {
+		rr := serve(manager, "GET", "/users", "", map[string]string{"Accept": tt.accept})
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("Accept %s: %d %s", tt.accept, rr.Code, rr.Header().Get("Content-Type"))
+		}
+		if rr.Body.String() != tt.body {
+			t.Errorf("Accept %s: body = %q, want %q", tt.accept, rr.Body.String(), tt.body)
+		}
+		if rr.Header().Get("Vary") != "Accept" {
+			t.Errorf("Accept %s: Vary = %q", tt.accept, rr.Header().Get("Vary"))
+		}
+	}
+
+	// XML は往復できる
+	rr := serve(manager, "GET", "/users", "", map[string]string{"Accept": "application/xml"})
+	var list userList
+	if err := xml.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list.Users, manager.GetAllUsers()) {
+		t.Errorf("XML users = %+v", list.Users)
+	}
+	rr = serve(manager, "GET", "/users/2", "", map[string]string{"Accept": "text/xml"})
+	if !strings.Contains(rr.Body.String(), "<user>") || !strings.Contains(rr.Body.String(), "<name>Bob</name>") {
+		t.Errorf("XML user = %s", rr.Body.String())
+	}
+
+	// 形式ごとに ETag が異なり、どの形式の ETag でも If-Match に使える
+	jsonTag := serve(manager, "GET", "/users/1", "", nil).Header().Get("ETag")
+	csvTag := serve(manager, "GET", "/users/1", "", map[string]string{"Accept": "text/csv"}).Header().Get("ETag")
+	if jsonTag == csvTag {
+		t.Error("Expected representations to have different ETags")
+	}
+	rr = serve(manager, "PATCH", "/users/1", `{"name":"Alicia"}`, map[string]string{"If-Match": csvTag})
+	if rr.Code != http.StatusOK {
+		t.Errorf("PATCH with CSV ETag = %d", rr.Code)
+	}
+
+	// 対応していない形式は 406
+	for _, path := range []string{"/users", "/users/1", "/users/99"} {
+		rr = serve(manager, "GET", path, "", map[string]string{"Accept": "text/html"})
+		if rr.Code != http.StatusNotAcceptable {
+			t.Errorf("GET %s Accept text/html = %d", path, rr.Code)
+		}
+	}
+	// 見つからないときの 404 も Accept で変わりうる
+	rr = serve(manager, "GET", "/users/99", "", nil)
+	if rr.Code != http.StatusNotFound || rr.Header().Get("Vary") != "Accept" {
+		t.Errorf("GET /users/99 = %d, Vary %q", rr.Code, rr.Header().Get("Vary"))
+	}
+	rr = serve(manager, "POST", "/users", `{"name":"Carol","email":"carol@example.com"}`, map[string]string{"Accept": "image/png"})
+	if rr.Code != http.StatusNotAcceptable || len(manager.GetAllUsers()) != 2 {
+		t.Errorf("POST Accept image/png = %d, users = %d", rr.Code, len(manager.GetAllUsers()))
+	}
+}
+
+func TestCreateUserFormats(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		invalid     []string
+	}{
+		{"csv", "text/csv", "name,email\nCarol,carol@example.com\n", http.StatusCreated, nil},
+		{"csv with id", "text/csv", "id,name,email\n7,Carol,carol@example.com\n", http.StatusCreated, nil},
+		{"csv unknown column", "text/csv", "name,email,age\nCarol,carol@example.com,3\n", http.StatusUnprocessableEntity, []string{"/age"}},
+		{"csv bad id", "text/csv", "id,name,email\nx,Carol,bad\n", http.StatusUnprocessableEntity, []string{"/id", "/email"}},
+		{"csv two rows", "text/csv", "name,email\nA,a@example.com\nB,b@example.com\n", http.StatusBadRequest, nil},
+		{"csv ragged", "text/csv", "name,email\nA\n", http.StatusBadRequest, nil},
+		{"xml", "application/xml", "<user><name>Carol</name><email>carol@example.com</email></user>", http.StatusCreated, nil},
+		{"xml invalid", "text/xml", "<user><name></name><email>x</email><age>3</age></user>", http.StatusUnprocessableEntity, []string{"/age", "/name", "/email"}},
+		{"xml fields", "text/xml", "<user><name></name><email>x</email></user>", http.StatusUnprocessableEntity, []string{"/name", "/email"}},
+		{"xml wrong root", "application/xml", "<person><name>Carol</name></person>", http.StatusBadRequest, nil},
+		{"xml malformed", "application/xml", "<user>", http.StatusBadRequest, nil},
+		{"ndjson", "application/x-ndjson", `{"name":"Carol","email":"carol@example.com"}` + "\n", http.StatusCreated, nil},
+		{"ndjson two lines", "application/x-ndjson", "{}\n{}\n", http.StatusBadRequest, nil},
+		{"unsupported", "text/plain", "Carol", http.StatusUnsupportedMediaType, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(&UserManager{}, "POST", "/users", tt.body, map[string]string{"Content-Type": tt.contentType})
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if tt.status == http.StatusUnsupportedMediaType && rr.Header().Get("Accept-Post") == "" {
+				t.Error("Expected Accept-Post header")
+			}
+			for _, pointer := range tt.invalid {
+				if !strings.Contains(rr.Body.String(), `"pointer":"`+pointer+`"`) {
+					t.Errorf("Expected invalid param %s in %s", pointer, rr.Body.String())
+				}
+			}
+		})
+	}
+
+	// CSV と XML でも、未知・重複したフィールドと値の問題を JSON と同じ順にまとめて返す
+	for _, tt := range []struct {
+		parse func([]byte) (User, error)
+		body  string
+	}{
+		{parseUserCSV, "name,email,extra,name\n,bad,1,x\n"},
+		{parseUserXML, "<user><name></name><email>bad</email><extra>1</extra><name>x</name></user>"},
+	} {
+		_, err := tt.parse([]byte(tt.body))
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) {
+			t.Fatalf("Expected ValidationError for %q, got %v", tt.body, err)
+		}
+		want := []InvalidParam{
+			{Pointer: "/email", Reason: "must be a valid email address"},
+			{Pointer: "/extra", Reason: "unknown field"},
+			{Pointer: "/name", Reason: "duplicate field"},
+		}
+		if !reflect.DeepEqual(invalid.Params, want) {
+			t.Errorf("%q: invalid params = %+v, want %+v", tt.body, invalid.Params, want)
+		}
+	}
+
+	// レスポンスは Accept の形式
+	rr := serve(&UserManager{}, "POST", "/users", "name,email\nCarol,carol@example.com\n",
+		map[string]string{"Content-Type": "text/csv", "Accept": "text/csv"})
+	if rr.Body.String() != "id,name,email\n1,Carol,carol@example.com\n" {
+		t.Errorf("CSV response = %q", rr.Body.String())
+	}
+}
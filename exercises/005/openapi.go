@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// openAPIVersion は、生成するドキュメントの OpenAPI のバージョン
+const openAPIVersion = "3.1.0"
+
+// apiParams は、apiRoute.Params で参照するパラメーターの定義
+var apiParams = map[string]map[string]any{
+	"id": {
+		"name": "id", "in": "path", "required": true,
+		"description": "User ID",
+		"schema":      map[string]any{"type": "integer", "minimum": 1},
+		"example":     1,
+	},
+	"limit": {
+		"name": "limit", "in": "query",
+		"description": "Number of users per page",
+		"schema":      map[string]any{"type": "integer", "minimum": 1, "maximum": maxPageSize, "default": defaultPageSize},
+	},
+	"cursor": {
+		"name": "cursor", "in": "query",
+		"description": "Opaque cursor taken from the next link of the previous page",
+		"schema":      map[string]any{"type": "string"},
+	},
+	"sort": {
+		"name": "sort", "in": "query",
+		"description": "Sort field; prefix with - for descending order",
+		"schema":      map[string]any{"type": "string", "enum": []string{"id", "-id", "name", "-name", "email", "-email"}, "default": "id"},
+	},
+	"q": {
+		"name": "q", "in": "query",
+		"description": "Case-insensitive substring of the name or email",
+		"schema":      map[string]any{"type": "string"},
+	},
+	"atomic": {
+		"name": "atomic", "in": "query",
+		"description": "Roll back every created user when any line fails",
+		"schema":      map[string]any{"type": "boolean", "default": false},
+	},
+	"If-None-Match": {
+		"name": "If-None-Match", "in": "header",
+		"description": "Return 304 Not Modified when one of the ETags matches",
+		"schema":      map[string]any{"type": "string"},
+	},
+	"If-Match": {
+		"name": "If-Match", "in": "header",
+		"description": "Apply the change only when the strong ETag matches the current user",
+		"schema":      map[string]any{"type": "string"},
+	},
+}
+
+// apiHeaders は、apiResponse.Headers で参照するレスポンスヘッダーの定義
+var apiHeaders = map[string]map[string]any{
+	"ETag": {
+		"description": "Strong entity tag of the representation",
+		"schema":      map[string]any{"type": "string"},
+	},
+	"X-Total-Count": {
+		"description": "Number of users matching the query",
+		"schema":      map[string]any{"type": "integer"},
+	},
+	"Link": {
+		"description": `RFC 8288 links with rel="first" and rel="next"`,
+		"schema":      map[string]any{"type": "string"},
+	},
+}
+
+// exampleUser は、ドキュメントに載せるユーザーの例
+var exampleUser = User{ID: 1, Name: "Alice", Email: "alice@example.com"}
+
+// jsonSchema は、Go の型から JSON Schema を作る
+// 構造体は json タグのフィールド名を使い、omitempty のないフィールドを必須にする
+func jsonSchema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]any{}
+		required := []string{}
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = jsonSchema(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return map[string]any{"type": "object", "properties": properties, "required": required, "additionalProperties": false}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Pointer:
+		return jsonSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	}
+	return map[string]any{}
+}
+
+// userSchema は、User の JSON Schema に validateUser と同じ制約を加える
+func userSchema() map[string]any {
+	schema := jsonSchema(reflect.TypeOf(User{}))
+	properties := schema["properties"].(map[string]any)
+	// id が 0（または省略）のときはサーバーが割り当てるので、0 も受け付ける
+	properties["id"].(map[string]any)["minimum"] = 0
+	properties["id"].(map[string]any)["description"] = "Assigned by the server when omitted or 0"
+	properties["name"].(map[string]any)["minLength"] = 1
+	properties["name"].(map[string]any)["maxLength"] = maxNameLength
+	properties["email"].(map[string]any)["format"] = "email"
+	properties["email"].(map[string]any)["maxLength"] = maxEmailLength
+	schema["required"] = []string{"name", "email"}
+	schema["examples"] = []any{exampleUser}
+	return schema
+}
+
+// userPatchSchema は、Merge Patch のスキーマ（null はフィールドの削除）
+func userPatchSchema() map[string]any {
+	schema := userSchema()
+	properties := schema["properties"].(map[string]any)
+	for name, p := range properties {
+		p := p.(map[string]any)
+		properties[name] = map[string]any{"anyOf": []any{p, map[string]any{"type": "null"}}}
+	}
+	delete(schema, "required")
+	schema["examples"] = []any{map[string]any{"name": "Alicia"}}
+	return schema
+}
+
+// openAPISchemas は、components/schemas に載せるスキーマ
+func openAPISchemas() map[string]any {
+	problem := jsonSchema(reflect.TypeOf(Problem{}))
+	problem["examples"] = []any{Problem{Type: "about:blank", Title: "Conflict", Status: http.StatusConflict, Detail: ErrEmailTaken.Error()}}
+
+	// 検証エラーの例は validateUser の実際の結果から作る
+	validation := jsonSchema(reflect.TypeOf(Problem{}))
+	validation["required"] = append(validation["required"].([]string), "invalid-params")
+	validation["examples"] = []any{Problem{
+		Type:          problemTypeValidation,
+		Title:         "Your request parameters didn't validate.",
+		Status:        http.StatusUnprocessableEntity,
+		InvalidParams: validateUser(User{Name: "Alice", Email: "alice"}),
+	}}
+
+	return map[string]any{
+		"User":              userSchema(),
+		"UserPatch":         userPatchSchema(),
+		"UserList":          map[string]any{"type": "array", "items": schemaRef("User"), "examples": []any{[]User{exampleUser}}},
+		"Problem":           problem,
+		"ValidationProblem": validation,
+		"BatchReport":       jsonSchema(reflect.TypeOf(BatchReport{})),
+		"OpenAPI":           map[string]any{"type": "object", "description": "OpenAPI 3.1 document"},
+	}
+}
+
+// schemaRef は、components/schemas への参照を返す
+func schemaRef(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// responseMediaTypes は、スキーマに対応するレスポンスのメディアタイプを返す
+func responseMediaTypes(schema string) []string {
+	switch {
+	case strings.HasSuffix(schema, "Problem"):
+		return []string{"application/problem+json"}
+	case schema == "User" || schema == "UserList":
+		return userMediaTypes
+	}
+	return []string{mediaJSON}
+}
+
+// mediaContent は、メディアタイプごとに同じスキーマを指す content を作る
+func mediaContent(mediaTypes []string, schema string) map[string]any {
+	content := map[string]any{}
+	for _, media := range mediaTypes {
+		content[media] = map[string]any{"schema": schemaRef(schema)}
+	}
+	return content
+}
+
+// OpenAPIDocument は、apiRoutes と User の json タグから OpenAPI 3.1 のドキュメントを作る
+func OpenAPIDocument() map[string]any {
+	paths := map[string]any{}
+	for _, route := range apiRoutes() {
+		operation := map[string]any{
+			"operationId": route.OperationID,
+			"summary":     route.Summary,
+		}
+		if len(route.Params) > 0 {
+			params := make([]any, len(route.Params))
+			for i, name := range route.Params {
+				params[i] = apiParams[name]
+			}
+			operation["parameters"] = params
+		}
+		if route.Request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  mediaContent(route.Request.MediaTypes, route.Request.Schema),
+			}
+		}
+
+		responses := map[string]any{}
+		for _, resp := range route.Responses {
+			response := map[string]any{"description": resp.Description}
+			if resp.Schema != "" {
+				response["content"] = mediaContent(responseMediaTypes(resp.Schema), resp.Schema)
+			}
+			if len(resp.Headers) > 0 {
+				headers := map[string]any{}
+				for _, name := range resp.Headers {
+					headers[name] = apiHeaders[name]
+				}
+				response["headers"] = headers
+			}
+			responses[strconv.Itoa(resp.Status)] = response
+		}
+		operation["responses"] = responses
+
+		item, _ := paths[route.Path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[route.Path] = item
+		}
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":   "Users API",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": openAPISchemas()},
+	}
+}
+
+var (
+	// openAPIOnce は、ドキュメントを一度だけ生成する
+	openAPIOnce sync.Once
+	// openAPIJSON は、生成したドキュメントのJSON
+	openAPIJSON []byte
+)
+
+// handleOpenAPI ハンドラーの実装（GET /openapi.json）
+func (um *UserManager) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		openAPIJSON, _ = json.MarshalIndent(OpenAPIDocument(), "", "  ")
+	})
+	w.Header().Set("Content-Type", "application/json")
+	writeCacheable(w, r, computeETag(openAPIJSON), openAPIJSON)
+}
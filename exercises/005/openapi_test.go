@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// collectRefs は、ドキュメント内の全ての $ref を集める
+func collectRefs(v any, refs *[]string) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if k == "$ref" {
+				*refs = append(*refs, child.(string))
+			}
+			collectRefs(child, refs)
+		}
+	case []any:
+		for _, child := range v {
+			collectRefs(child, refs)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	rr := serve(&UserManager{}, "GET", "/openapi.json", "", nil)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /openapi.json = %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["openapi"] != openAPIVersion {
+		t.Errorf("openapi = %v", doc["openapi"])
+	}
+
+	// 全てのルートが、定義したステータスコードとともに載っている
+	paths := doc["paths"].(map[string]any)
+	for _, route := range apiRoutes() {
+		op, ok := paths[route.Path].(map[string]any)[strings.ToLower(route.Method)].(map[string]any)
+		if !ok {
+			t.Errorf("%s %s is missing", route.Method, route.Path)
+			continue
+		}
+		responses := op["responses"].(map[string]any)
+		if len(responses) != len(route.Responses) {
+			t.Errorf("%s %s has %d responses, want %d", route.Method, route.Path, len(responses), len(route.Responses))
+		}
+	}
+
+	// User のプロパティは json タグと一致する
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	user := schemas["User"].(map[string]any)
+	var names []string
+	for name := range user["properties"].(map[string]any) {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if want := []string{"email", "id", "name"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("User properties = %v, want %v", names, want)
+	}
+	if len(user["examples"].([]any)) == 0 {
+		t.Error("User schema has no examples")
+	}
+	// id: 0 はサーバーに割り当てを頼む値なので、スキーマでも許す
+	if id := user["properties"].(map[string]any)["id"].(map[string]any); id["minimum"] != float64(0) {
+		t.Errorf("id minimum = %v, want 0", id["minimum"])
+	}
+
+	// 参照先のスキーマが全て存在する
+	var refs []string
+	collectRefs(doc, &refs)
+	if len(refs) == 0 {
+		t.Fatal("Expected schema references")
+	}
+	for _, ref := range refs {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("Unresolved reference %s", ref)
+		}
+	}
+
+	// ETag で再取得を省ける
+	rr = serve(&UserManager{}, "GET", "/openapi.json", "", map[string]string{"If-None-Match": rr.Header().Get("ETag")})
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d", rr.Code)
+	}
+	rr = serve(&UserManager{}, "POST", "/openapi.json", "", nil)
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "GET" {
+		t.Errorf("Expected 405 with Allow: GET, got %d %q", rr.Code, rr.Header().Get("Allow"))
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	type inner struct {
+		Flag bool `json:"flag"`
+	}
+	type sample struct {
+		Name    string   `json:"name"`
+		Tags    []string `json:"tags,omitempty"`
+		Inner   *inner   `json:"inner"`
+		Skipped int      `json:"-"`
+		hidden  int
+	}
+	got, _ := json.Marshal(jsonSchema(reflect.TypeOf(sample{})))
+	want := `{"additionalProperties":false,"properties":{"inner":{"additionalProperties":false,"properties":{"flag":{"type":"boolean"}},"required":["flag"],"type":"object"},"name":{"type":"string"},"tags":{"items":{"type":"string"},"type":"array"}},"required":["name","inner"],"type":"object"}`
+	if string(got) != want {
+		t.Errorf("jsonSchema = %s\nwant %s", got, want)
+	}
+}
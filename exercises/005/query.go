@@ -0,0 +1,223 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultPageSize は、limit を省略したときの1ページの件数
+	defaultPageSize = 100
+	// maxPageSize は、limit に指定できる最大値
+	maxPageSize = 1000
+)
+
+// ErrInvalidQuery は、一覧取得のクエリパラメーターが不正なときのエラー
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ListOptions は、ユーザー一覧の取得条件
+type ListOptions struct {
+	Query  string  // 名前またはメールアドレスに含まれる文字列（大文字小文字を区別しない）
+	Sort   string  // name, email, id（先頭に - を付けると降順）
+	Limit  int     // 1ページの件数
+	Cursor *Cursor // 前のページの最後の位置（nil なら先頭から）
+}
+
+// Cursor は、ページの続きの位置を表す（クライアントには不透明な文字列として渡す）
+type Cursor struct {
+	Sort  string `json:"s"`
+	Query string `json:"q,omitempty"`
+	Key   string `json:"k,omitempty"` // 最後のユーザーのソートキー
+	ID    int    `json:"i"`           // 最後のユーザーの ID
+}
+
+// Encode は、カーソルを URL に使える文字列にする
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor は、Encode した文字列からカーソルを復元する
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return &c, nil
+}
+
+// UserPage は、ユーザー一覧の1ページ
+type UserPage struct {
+	Users []User
+	Total int     // 条件に一致するユーザーの総数
+	Next  *Cursor // 次のページの位置（最後のページなら nil）
+}
+
+// sortKey は、ソート指定からフィールド名と降順かどうかを返す
+func sortKey(spec string) (field string, desc bool, err error) {
+	field = strings.TrimPrefix(spec, "-")
+	desc = strings.HasPrefix(spec, "-")
+	switch field {
+	case "", "id":
+		return "id", desc, nil
+	case "name", "email":
+		return field, desc, nil
+	}
+	return "", false, fmt.Errorf("%w: unknown sort field %q", ErrInvalidQuery, field)
+}
+
+// fieldValue は、ソートに使うフィールドの値を返す
+func fieldValue(u User, field string) string {
+	switch field {
+	case "name":
+		return u.Name
+	case "email":
+		return u.Email
+	}
+	return ""
+}
+
+// sortEntry は、小文字にしたソートキーを並べ替えの前に一度だけ求めておいたユーザー
+type sortEntry struct {
+	user  User
+	key   string // ソートに使うフィールドの値
+	lower string // key を小文字にしたもの
+}
+
+// newSortEntry は、u の field の値をソートキーにした sortEntry を返す
+func newSortEntry(u User, field string) sortEntry {
+	key := fieldValue(u, field)
+	return sortEntry{user: u, key: key, lower: strings.ToLower(key)}
+}
+
+// compareEntries は、フィールドの値（大文字小文字を区別しない）→ ID の順で比較する
+func compareEntries(a, b sortEntry, desc bool) int {
+	c := cmp.Compare(a.lower, b.lower)
+	if c == 0 {
+		c = cmp.Compare(a.key, b.key)
+	}
+	if c == 0 {
+		c = cmp.Compare(a.user.ID, b.user.ID)
+	}
+	if desc {
+		return -c
+	}
+	return c
+}
+
+// ListUsers メソッドの実装
+// 条件に一致するユーザーを並べ替え、カーソルの位置から Limit 件を返す
+// 小文字にしたキーはユーザーごとに一度だけ求める（比較のたびに求めると、ユーザー数×log の割り当てになる）
+func (um *UserManager) ListUsers(opts ListOptions) (UserPage, error) {
+	field, desc, err := sortKey(opts.Sort)
+	if err != nil {
+		return UserPage{}, err
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	// カーソルは同じ条件の一覧でのみ使える
+	if c := opts.Cursor; c != nil && (c.Sort != opts.Sort || c.Query != opts.Query) {
+		return UserPage{}, fmt.Errorf("%w: cursor does not match sort or q", ErrInvalidQuery)
+	}
+
+	// 1. 検索語で絞り込みながら、ソートキーを求める
+	q := strings.ToLower(opts.Query)
+	var matched []sortEntry
+	um.mu.RLock()
+	for _, u := range um.users {
+		if q == "" || strings.Contains(strings.ToLower(u.Name), q) || strings.Contains(strings.ToLower(u.Email), q) {
+			matched = append(matched, newSortEntry(u, field))
+		}
+	}
+	um.mu.RUnlock()
+
+	// 2. 並べ替える
+	slices.SortFunc(matched, func(a, b sortEntry) int {
+		return compareEntries(a, b, desc)
+	})
+
+	// 3. カーソルより後ろの位置を二分探索で探す
+	start := 0
+	if c := opts.Cursor; c != nil {
+		after := sortEntry{user: User{ID: c.ID}, key: c.Key, lower: strings.ToLower(c.Key)}
+		start, _ = slices.BinarySearchFunc(matched, after, func(e, after sortEntry) int {
+			if compareEntries(e, after, desc) <= 0 {
+				return -1
+			}
+			return 1
+		})
+	}
+
+	// 4. Limit 件を切り出し、続きがあれば次のカーソルを作る
+	end := min(start+limit, len(matched))
+	page := UserPage{Users: make([]User, 0, max(end-start, 0)), Total: len(matched)}
+	for _, e := range matched[start:end] {
+		page.Users = append(page.Users, e.user)
+	}
+	if end < len(matched) {
+		last := matched[end-1]
+		page.Next = &Cursor{Sort: opts.Sort, Query: opts.Query, Key: last.key, ID: last.user.ID}
+	}
+	return page, nil
+}
+
+// parseListOptions は、クエリパラメーター limit, sort, q, cursor を読み取る
+func parseListOptions(values url.Values) (ListOptions, error) {
+	opts := ListOptions{Query: values.Get("q"), Sort: values.Get("sort")}
+	if s := values.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return opts, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, maxPageSize)
+		}
+		opts.Limit = limit
+	}
+	if s := values.Get("cursor"); s != "" {
+		c, err := DecodeCursor(s)
+		if err != nil {
+			return opts, err
+		}
+		opts.Cursor = c
+	}
+	return opts, nil
+}
+
+// pageLinks は、RFC 8288 の Link ヘッダーの値を作る
+func pageLinks(r *http.Request, opts ListOptions, next *Cursor) string {
+	link := func(cursor *Cursor, rel string) string {
+		values := url.Values{}
+		if opts.Query != "" {
+			values.Set("q", opts.Query)
+		}
+		if opts.Sort != "" {
+			values.Set("sort", opts.Sort)
+		}
+		if opts.Limit != 0 {
+			values.Set("limit", strconv.Itoa(opts.Limit))
+		}
+		if cursor != nil {
+			values.Set("cursor", cursor.Encode())
+		}
+		u := url.URL{Path: r.URL.Path, RawQuery: values.Encode()}
+		return fmt.Sprintf("<%s>; rel=%q", u.String(), rel)
+	}
+
+	links := []string{link(nil, "first")}
+	if next != nil {
+		links = append(links, link(next, "next"))
+	}
+	return strings.Join(links, ", ")
+}
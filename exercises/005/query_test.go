@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func newQueryTestManager() *UserManager {
+	manager := &UserManager{}
+	for _, u := range []User{
+		{Name: "alice", Email: "alice@example.com"},
+		{Name: "Bob", Email: "bob@corp.example"},
+		{Name: "carol", Email: "carol@example.com"},
+		{Name: "Dave", Email: "dave@corp.example"},
+		{Name: "alice", Email: "alice2@corp.example"},
+	} {
+		manager.AddUser(u)
+	}
+	return manager
+}
+
+func ids(users []User) []int {
+	result := []int{}
+	for _, u := range users {
+		result = append(result, u.ID)
+	}
+	return result
+}
+
+func TestListUsersSortAndFilter(t *testing.T) {
+	manager := newQueryTestManager()
+
+	tests := []struct {
+		opts ListOptions
+		want []int
+	}{
+		{ListOptions{}, []int{1, 2, 3, 4, 5}},
+		{ListOptions{Sort: "-id"}, []int{5, 4, 3, 2, 1}},
+		// 名前は大文字小文字を区別せず、同じ名前は ID 順
+		{ListOptions{Sort: "name"}, []int{1, 5, 2, 3, 4}},
+		{ListOptions{Sort: "-name"}, []int{4, 3, 2, 5, 1}},
+		{ListOptions{Sort: "email"}, []int{5, 1, 2, 3, 4}},
+		{ListOptions{Query: "CORP"}, []int{2, 4, 5}},
+		{ListOptions{Query: "ali", Sort: "-id"}, []int{5, 1}},
+		{ListOptions{Query: "nobody"}, []int{}},
+	}
+
+	for _, tt := range tests {
+		page, err := manager.ListUsers(tt.opts)
+		if err != nil {
+			t.Fatalf("ListUsers(%+v) failed: %v", tt.opts, err)
+		}
+		if got := ids(page.Users); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListUsers(%+v) = %v, want %v", tt.opts, got, tt.want)
+		}
+		if page.Total != len(tt.want) || page.Next != nil {
+			t.Errorf("ListUsers(%+v) total = %d, next = %v", tt.opts, page.Total, page.Next)
+		}
+	}
+
+	if _, err := manager.ListUsers(ListOptions{Sort: "age"}); err == nil {
+		t.Error("Expected error for unknown sort field")
+	}
+}
+
+func TestListUsersCursorPaging(t *testing.T) {
+	manager := &UserManager{}
+	for i := 0; i < 25; i++ {
+		manager.AddUser(User{Name: fmt.Sprintf("user%02d", i%7), Email: fmt.Sprintf("u%d@example.com", i)})
+	}
+
+	for _, sort := range []string{"", "-id", "name", "-name", "email"} {
+		full, _ := manager.ListUsers(ListOptions{Sort: sort, Limit: maxPageSize})
+
+		var paged []int
+		opts := ListOptions{Sort: sort, Limit: 4}
+		for {
+			page, err := manager.ListUsers(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paged = append(paged, ids(page.Users)...)
+			if page.Next == nil {
+				break
+			}
+			// カーソルは文字列にして往復させる
+			opts.Cursor, err = DecodeCursor(page.Next.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !reflect.DeepEqual(paged, ids(full.Users)) {
+			t.Errorf("sort=%q paged = %v, want %v", sort, paged, ids(full.Users))
+		}
+	}
+
+	// 前のページの途中のユーザーが削除されてもページが崩れない
+	page, _ := manager.ListUsers(ListOptions{Limit: 5})
+	manager.DeleteUser(5)
+	next, _ := manager.ListUsers(ListOptions{Limit: 5, Cursor: page.Next})
+	if got := ids(next.Users); !reflect.DeepEqual(got, []int{6, 7, 8, 9, 10}) {
+		t.Errorf("page after delete = %v", got)
+	}
+
+	// 条件が変わったカーソルは使えない
+	if _, err := manager.ListUsers(ListOptions{Sort: "name", Cursor: page.Next}); err == nil {
+		t.Error("Expected error for cursor with different sort")
+	}
+}
+
+func TestListUsersAllocations(t *testing.T) {
+	manager := &UserManager{}
+	const n = 10000
+	for i := range n {
+		manager.AddUser(User{Name: fmt.Sprintf("User %05d", (i*7919)%n), Email: fmt.Sprintf("User%d@Example.com", i)})
+	}
+
+	// 小文字にしたキーはユーザーごとに一度だけ求めるので、割り当てはユーザー数に比例する程度で済む
+	for _, sort := range []string{"name", "-email"} {
+		allocs := testing.AllocsPerRun(3, func() {
+			manager.ListUsers(ListOptions{Sort: sort, Limit: 10})
+		})
+		if allocs > 2*n {
+			t.Errorf("sort=%s: ListUsers allocates %v times for %d users", sort, allocs, n)
+		}
+	}
+}
+
+func TestHandleGetUsersPagination(t *testing.T) {
+	manager := newQueryTestManager()
+
+	rr := serve(manager, "GET", "/users?limit=2&sort=name", "", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("X-Total-Count"); got != "5" {
+		t.Errorf("X-Total-Count = %q, want 5", got)
+	}
+
+	// Link ヘッダーの next をたどって全件を取得する
+	nextLink := regexp.MustCompile(`<([^>]+)>; rel="next"`)
+	var all []int
+	for {
+		var users []User
+		if err := json.Unmarshal(rr.Body.Bytes(), &users); err != nil {
+			t.Fatal(err)
+		}
+		if len(users) > 2 {
+			t.Errorf("page has %d users, want <= 2", len(users))
+		}
+		all = append(all, ids(users)...)
+
+		link := rr.Header().Get("Link")
+		if !regexp.MustCompile(`rel="first"`).MatchString(link) {
+			t.Errorf("Link header %q has no first relation", link)
+		}
+		m := nextLink.FindStringSubmatch(link)
+		if m == nil {
+			break
+		}
+		u, err := url.Parse(m[1])
+		if err != nil || u.Query().Get("sort") != "name" || u.Query().Get("limit") != "2" {
+			t.Fatalf("next link %q does not keep the query", m[1])
+		}
+		rr = serve(manager, "GET", m[1], "", nil)
+	}
+	if want := []int{1, 5, 2, 3, 4}; !reflect.DeepEqual(all, want) {
+		t.Errorf("all pages = %v, want %v", all, want)
+	}
+}
+
+func TestHandleGetUsersInvalidQuery(t *testing.T) {
+	manager := newQueryTestManager()
+	for _, path := range []string{
+		"/users?limit=0",
+		"/users?limit=abc",
+		"/users?limit=100000",
+		"/users?sort=age",
+		"/users?cursor=!!!",
+		"/users?cursor=" + (&Cursor{Sort: "name"}).Encode(),
+	} {
+		rr := serve(manager, "GET", path, "", nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("GET %s status = %d, want %d", path, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// apiRoute は、1つの操作（メソッドとパスの組）の定義
+// ルーティングと OpenAPI のドキュメントの両方がこの表から作られる
+type apiRoute struct {
+	Method      string
+	Path        string // OpenAPI のパステンプレート（/users/{id} など）
+	OperationID string
+	Summary     string
+	Params      []string      // apiParams のキー
+	Request     *apiRequest   // リクエストボディ（なければ nil）
+	Responses   []apiResponse // 返しうるステータスコード
+	handle      func(um *UserManager, w http.ResponseWriter, r *http.Request)
+}
+
+// apiRequest は、リクエストボディの定義
+type apiRequest struct {
+	MediaTypes []string
+	Schema     string // components/schemas の名前
+}
+
+// apiResponse は、レスポンスの定義
+type apiResponse struct {
+	Status      int
+	Description string
+	Schema      string   // components/schemas の名前（ボディがなければ空）
+	Headers     []string // apiHeaders のキー
+}
+
+// problem は、problem+json で返すエラーレスポンスを定義する
+func problem(status int, description string) apiResponse {
+	schema := "Problem"
+	if status == http.StatusUnprocessableEntity {
+		schema = "ValidationProblem"
+	}
+	return apiResponse{Status: status, Description: description, Schema: schema}
+}
+
+// apiRoutes は、提供する全ての操作を返す
+// （ハンドラーがこの表から作ったドキュメントを返すので、変数の初期化の循環を避けて関数にしている）
+func apiRoutes() []apiRoute {
+	return []apiRoute{
+		{
+			Method: http.MethodGet, Path: "/users", OperationID: "listUsers",
+			Summary: "List users with paging, sorting and search",
+			Params:  []string{"limit", "cursor", "sort", "q", "If-None-Match"},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "A page of users", Schema: "UserList", Headers: []string{"ETag", "X-Total-Count", "Link"}},
+				{Status: http.StatusNotModified, Description: "The representation matches If-None-Match", Headers: []string{"ETag"}},
+				problem(http.StatusBadRequest, "Invalid query parameter"),
+				problem(http.StatusNotAcceptable, "None of the Accept media types is supported"),
+			},
+			handle: (*UserManager).handleGetUsers,
+		},
+		{
+			Method: http.MethodPost, Path: "/users", OperationID: "createUser",
+			Summary: "Create a user (the server assigns an ID when id is omitted)",
+			Request: &apiRequest{MediaTypes: userMediaTypes, Schema: "User"},
+			Responses: []apiResponse{
+				{Status: http.StatusCreated, Description: "The created user", Schema: "User", Headers: []string{"ETag"}},
+				problem(http.StatusBadRequest, "Malformed JSON"),
+				problem(http.StatusNotAcceptable, "None of the Accept media types is supported"),
+				problem(http.StatusConflict, "The ID or email is already taken"),
+				problem(http.StatusRequestEntityTooLarge, "Request body too large"),
+				problem(http.StatusUnsupportedMediaType, "Unsupported Content-Type"),
+				problem(http.StatusUnprocessableEntity, "One or more fields are invalid"),
+			},
+			handle: (*UserManager).handleCreateUser,
+		},
+		{
+			Method: http.MethodGet, Path: "/users/{id}", OperationID: "getUser",
+			Summary: "Get a user",
+			Params:  []string{"id", "If-None-Match"},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "The user", Schema: "User", Headers: []string{"ETag"}},
+				{Status: http.StatusNotModified, Description: "The representation matches If-None-Match", Headers: []string{"ETag"}},
+				problem(http.StatusBadRequest, "The ID is not an integer"),
+				problem(http.StatusNotFound, "User not found"),
+				problem(http.StatusNotAcceptable, "None of the Accept media types is supported"),
+			},
+			handle: (*UserManager).handleGetUser,
+		},
+		{
+			Method: http.MethodPut, Path: "/users/{id}", OperationID: "replaceUser",
+			Summary: "Replace a user",
+			Params:  []string{"id", "If-Match"},
+			Request: &apiRequest{MediaTypes: []string{mediaJSON}, Schema: "User"},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "The replaced user", Schema: "User", Headers: []string{"ETag"}},
+				problem(http.StatusBadRequest, "Malformed JSON or the body ID differs from the path"),
+				problem(http.StatusNotFound, "User not found"),
+				problem(http.StatusNotAcceptable, "None of the Accept media types is supported"),
+				problem(http.StatusConflict, "The email is already taken"),
+				problem(http.StatusPreconditionFailed, "If-Match does not match the current ETag"),
+				problem(http.StatusRequestEntityTooLarge, "Request body too large"),
+				problem(http.StatusUnprocessableEntity, "One or more fields are invalid"),
+			},
+			handle: (*UserManager).handleReplaceUser,
+		},
+		{
+			Method: http.MethodPatch, Path: "/users/{id}", OperationID: "patchUser",
+			Summary: "Update a user with a JSON Merge Patch (RFC 7396)",
+			Params:  []string{"id", "If-Match"},
+			Request: &apiRequest{MediaTypes: []string{"application/merge-patch+json", mediaJSON}, Schema: "UserPatch"},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "The updated user", Schema: "User", Headers: []string{"ETag"}},
+				problem(http.StatusBadRequest, "Malformed JSON or the patch changes the ID"),
+				problem(http.StatusNotFound, "User not found"),
+				problem(http.StatusNotAcceptable, "None of the Accept media types is supported"),
+				problem(http.StatusConflict, "The email is already taken"),
+				problem(http.StatusPreconditionFailed, "If-Match does not match the current ETag"),
+				problem(http.StatusRequestEntityTooLarge, "Request body too large"),
+				problem(http.StatusUnsupportedMediaType, "Unsupported patch media type"),
+				problem(http.StatusUnprocessableEntity, "The patched user is invalid"),
+			},
+			handle: (*UserManager).handlePatchUser,
+		},
+		{
+			Method: http.MethodDelete, Path: "/users/{id}", OperationID: "deleteUser",
+			Summary: "Delete a user",
+			Params:  []string{"id", "If-Match"},
+			Responses: []apiResponse{
+				{Status: http.StatusNoContent, Description: "The user was deleted"},
+				problem(http.StatusBadRequest, "The ID is not an integer"),
+				problem(http.StatusNotFound, "User not found"),
+				problem(http.StatusPreconditionFailed, "If-Match does not match the current ETag"),
+			},
+			handle: (*UserManager).handleDeleteUser,
+		},
+		{
+			Method: http.MethodPost, Path: "/users:batch", OperationID: "importUsers",
+			Summary: "Import users from an NDJSON stream, one user per line",
+			Params:  []string{"atomic"},
+			Request: &apiRequest{MediaTypes: []string{mediaNDJSON}, Schema: "User"},
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "Per-line results", Schema: "BatchReport"},
+				{Status: http.StatusBadRequest, Description: "The body could not be read to the end; earlier lines may have been created", Schema: "BatchReport"},
+				problem(http.StatusUnsupportedMediaType, "Unsupported Content-Type"),
+				{Status: http.StatusUnprocessableEntity, Description: "A line failed in atomic mode and the batch was rolled back", Schema: "BatchReport"},
+			},
+			handle: (*UserManager).handleImportUsers,
+		},
+		{
+			Method: http.MethodGet, Path: "/openapi.json", OperationID: "getOpenAPI",
+			Summary: "Get the OpenAPI 3.1 document of this API",
+			Responses: []apiResponse{
+				{Status: http.StatusOK, Description: "The OpenAPI document", Schema: "OpenAPI"},
+			},
+			handle: (*UserManager).handleOpenAPI,
+		},
+	}
+}
+
+// routeTable は、パステンプレートごとの操作の一覧（Routes で一度だけ作る）
+type routeTable map[string][]apiRoute
+
+// newRouteTable は、routes をパステンプレートごとにまとめる
+func newRouteTable(routes []apiRoute) routeTable {
+	table := routeTable{}
+	for _, route := range routes {
+		table[route.Path] = append(table[route.Path], route)
+	}
+	return table
+}
+
+// dispatch は、パステンプレートに登録された操作をメソッドで選んで実行する
+// 該当するメソッドがなければ Allow ヘッダーを付けて 405 を返す
+func (t routeTable) dispatch(um *UserManager, path string, w http.ResponseWriter, r *http.Request) {
+	var allow []string
+	for _, route := range t[path] {
+		if route.Method == r.Method {
+			route.handle(um, w, r)
+			return
+		}
+		allow = append(allow, route.Method)
+	}
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrServerStarted は、起動済みのサーバーをもう一度起動したときのエラー
+var ErrServerStarted = errors.New("server already started")
+
+// ServerConfig は、サーバーの設定（ゼロ値の項目は既定値になる）
+type ServerConfig struct {
+	Addr              string        // 待ち受けるアドレス（既定値 ":8080"、":0" なら空いているポート）
+	ReadHeaderTimeout time.Duration // リクエストヘッダーを読み終えるまでの時間
+	ReadTimeout       time.Duration // リクエスト全体を読み終えるまでの時間
+	WriteTimeout      time.Duration // レスポンスを書き終えるまでの時間
+	IdleTimeout       time.Duration // keep-alive の接続を次のリクエストまで保つ時間
+}
+
+// shutdownTimeout は、StartServer が停止時に処理中のリクエストを待つ時間
+const shutdownTimeout = 15 * time.Second
+
+// DefaultServerConfig は、StartServer が使う設定
+var DefaultServerConfig = ServerConfig{
+	Addr:              ":8080",
+	ReadHeaderTimeout: 5 * time.Second,
+	ReadTimeout:       10 * time.Second,
+	WriteTimeout:      10 * time.Second,
+	IdleTimeout:       60 * time.Second,
+}
+
+// withDefaults は、ゼロ値の項目を既定値で埋めた設定を返す
+func (c ServerConfig) withDefaults() ServerConfig {
+	d := DefaultServerConfig
+	if c.Addr == "" {
+		c.Addr = d.Addr
+	}
+	if c.ReadHeaderTimeout == 0 {
+		c.ReadHeaderTimeout = d.ReadHeaderTimeout
+	}
+	if c.ReadTimeout == 0 {
+		c.ReadTimeout = d.ReadTimeout
+	}
+	if c.WriteTimeout == 0 {
+		c.WriteTimeout = d.WriteTimeout
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = d.IdleTimeout
+	}
+	return c
+}
+
+// Server は、UserManager の API を提供する停止可能な HTTP サーバー
+// http.DefaultServeMux は使わず、自分の ServeMux だけを公開する
+type Server struct {
+	config ServerConfig
+	http   *http.Server
+
+	mu       sync.Mutex
+	listener net.Listener
+	done     chan struct{} // Serve が戻ると閉じる
+	err      error         // Serve が http.ErrServerClosed 以外で終わったときのエラー
+}
+
+// NewServer は、manager.Routes() を提供するサーバーを作る
+func NewServer(manager *UserManager, config ServerConfig) *Server {
+	return newServer(manager.Routes(), config)
+}
+
+// newServer は、任意のハンドラーを提供するサーバーを作る
+func newServer(handler http.Handler, config ServerConfig) *Server {
+	config = config.withDefaults()
+	return &Server{
+		config: config,
+		http: &http.Server{
+			Addr:              config.Addr,
+			Handler:           handler,
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			ReadTimeout:       config.ReadTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+		},
+	}
+}
+
+// Start は、アドレスで待ち受けを始め、別の goroutine でリクエストの処理を始める
+// ポートが使用中などで待ち受けられないときはエラーを返す
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener != nil {
+		return ErrServerStarted
+	}
+
+	ln, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		if err := s.http.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// Addr は、待ち受けている実際のアドレスを返す（起動前は設定のアドレス）
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return s.config.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Done は、リクエストの処理が終わると閉じるチャネルを返す（起動前は nil）
+func (s *Server) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+// Shutdown は、新しい接続の受け付けをやめ、処理中のリクエストが終わるのを待って停止する
+// ctx が先に終わったときは残りの接続を閉じて ctx のエラーを返す
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+
+	if err := s.http.Shutdown(ctx); err != nil {
+		s.http.Close()
+		return err
+	}
+	<-done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
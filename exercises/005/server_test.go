@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServerStartAndShutdown(t *testing.T) {
+	server := NewServer(newTestManager(), ServerConfig{Addr: "127.0.0.1:0"})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Start(); !errors.Is(err, ErrServerStarted) {
+		t.Errorf("Expected ErrServerStarted, got %v", err)
+	}
+
+	resp, err := http.Get("http://" + server.Addr() + "/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var user User
+	json.NewDecoder(resp.Body).Decode(&user)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || user.Name != "Alice" {
+		t.Errorf("Unexpected response %d %+v", resp.StatusCode, user)
+	}
+
+	// DefaultServeMux には何も登録しない
+	if _, pattern := http.DefaultServeMux.Handler(&http.Request{Method: "GET", URL: resp.Request.URL}); pattern != "" {
+		t.Errorf("Expected DefaultServeMux to be untouched, got pattern %q", pattern)
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get("http://" + server.Addr() + "/users"); err == nil {
+		t.Error("Expected request after shutdown to fail")
+	}
+}
+
+func TestServerStartAddrInUse(t *testing.T) {
+	first := NewServer(&UserManager{}, ServerConfig{Addr: "127.0.0.1:0"})
+	if err := first.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer first.Shutdown(context.Background())
+
+	second := NewServer(&UserManager{}, ServerConfig{Addr: first.Addr()})
+	if err := second.Start(); err == nil {
+		second.Shutdown(context.Background())
+		t.Error("Expected error for address in use")
+	}
+}
+
+func TestServerShutdownDrainsRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+	server := newServer(handler, ServerConfig{Addr: "127.0.0.1:0"})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		body string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + server.Addr() + "/")
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		results <- result{string(body), err}
+	}()
+	<-started
+
+	// 処理中のリクエストがあるので、期限付きの Shutdown は間に合わない
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- server.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned before the request finished: %v", err)
+	case <-ctx.Done():
+	}
+
+	// リクエストが終わると Shutdown も戻る
+	close(release)
+	if r := <-results; r.err != nil || r.body != "done" {
+		t.Errorf("In-flight request = %q, %v", r.body, r.err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	server := newServer(handler, ServerConfig{Addr: "127.0.0.1:0"})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go http.Get("http://" + server.Addr() + "/")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestServerConfigDefaults(t *testing.T) {
+	config := ServerConfig{WriteTimeout: time.Second}.withDefaults()
+	if config.Addr != ":8080" || config.WriteTimeout != time.Second || config.IdleTimeout != DefaultServerConfig.IdleTimeout {
+		t.Errorf("Unexpected config %+v", config)
+	}
+}
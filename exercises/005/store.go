@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// walFileName は、変更を追記していく write-ahead log のファイル名
+	walFileName = "users.wal"
+	// snapshotFileName は、コンパクションで書き出すスナップショットのファイル名
+	snapshotFileName = "users.snapshot.json"
+	// walHeaderSize は、レコードの先頭のヘッダー（長さ 4 バイト + CRC-32C 4 バイト）
+	walHeaderSize = 8
+	// maxWALRecordSize は、1レコードのペイロードの上限
+	maxWALRecordSize = 1 << 20
+)
+
+// ErrCorruptWAL は、ログの途中のレコードが壊れているときのエラー
+// 末尾の書きかけのレコードは修復できるが、途中の破損は修復しない
+var ErrCorruptWAL = errors.New("corrupt write-ahead log")
+
+// ErrStoreClosed は、閉じたストアに書き込もうとしたときのエラー
+var ErrStoreClosed = errors.New("store is closed")
+
+// crcTable は、レコードのチェックサムに使う CRC-32C のテーブル
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// StoreOptions は、ファイルに永続化する UserManager の設定
+type StoreOptions struct {
+	CompactInterval  time.Duration // 定期的にコンパクションする間隔（0 なら 1 分、負なら定期実行しない）
+	CompactThreshold int           // ログのレコード数がこれに達したらコンパクションする（0 なら 1000、負なら数で判断しない）
+	NoSync           bool          // true ならレコードごとの fsync を省く（速いがクラッシュで最後の変更を失うことがある）
+}
+
+// ReplayStats は、起動時にログを再生した結果
+type ReplayStats struct {
+	Snapshot  int   // スナップショットから読み込んだユーザー数
+	Records   int   // 再生したレコード数
+	Skipped   int   // スナップショットに含まれていたので再生しなかったレコード数
+	Truncated int64 // 末尾の書きかけのレコードとして切り詰めたバイト数
+}
+
+// walOp は、ログに記録する変更の種類
+type walOp string
+
+const (
+	opPut    walOp = "put"    // ユーザーの追加または置き換え
+	opDelete walOp = "delete" // ユーザーの削除
+)
+
+// walRecord は、ログの1レコード（JSON で記録する）
+type walRecord struct {
+	Seq  uint64 `json:"seq,omitempty"` // 1 から順に増える通し番号（コンパクションしても戻らない）
+	Op   walOp  `json:"op"`
+	User *User  `json:"user,omitempty"`
+	ID   int    `json:"id,omitempty"`
+}
+
+// snapshot は、スナップショットファイルの内容
+type snapshot struct {
+	Seq    uint64 `json:"seq,omitempty"` // 含まれている最後のレコードの通し番号
+	NextID int    `json:"next_id"`
+	Users  []User `json:"users"`
+}
+
+// userStore は、UserManager の変更を記録するファイル群
+// 書き込みは全て UserManager のロックを保持した状態で行う
+type userStore struct {
+	dir     string
+	opts    StoreOptions
+	wal     *os.File
+	size    int64  // 正常に書き込めたログの長さ
+	seq     uint64 // 最後に書き込んだレコードの通し番号
+	records int    // 最後のコンパクション以降のレコード数
+	broken  error  // ログを元の長さに戻せなかったときのエラー（以降の書き込みを拒否する）
+	stats   ReplayStats
+
+	closing bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// OpenUserManager は、dir のスナップショットとログから UserManager を復元する
+// 以降の変更は全てログに追記されてから反映され、定期的にスナップショットにまとめられる
+func OpenUserManager(dir string, opts StoreOptions) (*UserManager, error) {
+	if opts.CompactInterval == 0 {
+		opts.CompactInterval = time.Minute
+	}
+	if opts.CompactThreshold == 0 {
+		opts.CompactThreshold = 1000
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	// 1. スナップショットを読み込む（store を付ける前なのでログには記録されない）
+	um := &UserManager{}
+	stats := ReplayStats{}
+	snap, err := readSnapshot(filepath.Join(dir, snapshotFileName))
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range snap.Users {
+		if _, err := um.AddUser(u); err != nil {
+			return nil, fmt.Errorf("snapshot: user %d: %w", u.ID, err)
+		}
+	}
+	um.nextID = max(um.nextID, snap.NextID)
+	stats.Snapshot = len(snap.Users)
+
+	// 2. ログを再生し、書きかけの末尾を切り詰める
+	wal, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	replay, err := replayWAL(wal, um, snap.Seq)
+	if err != nil {
+		wal.Close()
+		return nil, err
+	}
+	info, err := wal.Stat()
+	if err != nil {
+		wal.Close()
+		return nil, err
+	}
+	if stats.Truncated = info.Size() - replay.size; stats.Truncated > 0 {
+		if err := wal.Truncate(replay.size); err != nil {
+			wal.Close()
+			return nil, err
+		}
+	}
+	if _, err := wal.Seek(replay.size, io.SeekStart); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	stats.Records, stats.Skipped = replay.records-replay.skipped, replay.skipped
+
+	// 3. ストアを付けて、定期的なコンパクションを始める
+	um.store = &userStore{
+		dir: dir, opts: opts, wal: wal,
+		size: replay.size, seq: max(snap.Seq, replay.seq), records: replay.records,
+		stats: stats, stop: make(chan struct{}),
+	}
+	if opts.CompactInterval > 0 {
+		um.store.wg.Add(1)
+		go um.compactPeriodically(opts.CompactInterval)
+	}
+	return um, nil
+}
+
+// readSnapshot は、スナップショットを読み込む（ファイルがなければ空）
+func readSnapshot(path string) (snapshot, error) {
+	var snap snapshot
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return snap, nil
+	}
+	if err != nil {
+		return snap, err
+	}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("snapshot %s: %w", path, err)
+	}
+	return snap, nil
+}
+
+// walReplay は、replayWAL の結果
+type walReplay struct {
+	size    int64  // 正常なレコードが続く長さ
+	records int    // 正常なレコードの数
+	skipped int    // そのうちスナップショットに含まれていたので飛ばした数
+	seq     uint64 // 最後のレコードの通し番号
+}
+
+// replayWAL は、ログのレコードのうち通し番号が after より大きいものを um に適用する
+// コンパクションでスナップショットを書いた後、ログを空にする前に止まると、ログにはスナップショットに
+// 含まれたレコードが残る。これを再び適用すると重複エラーになるので、通し番号で飛ばす
+// 末尾の書きかけのレコード（長さが足りない、または最後のレコードのチェックサムが合わない）は無視する
+// 途中のレコードの長さやチェックサムが壊れているときは ErrCorruptWAL を返す
+func replayWAL(r io.Reader, um *UserManager, after uint64) (walReplay, error) {
+	var replay walReplay
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return replay, err
+	}
+
+	var offset int64
+	for rest := data; len(rest) > 0; {
+		if len(rest) < walHeaderSize {
+			break
+		}
+		n := binary.LittleEndian.Uint32(rest[0:4])
+		sum := binary.LittleEndian.Uint32(rest[4:8])
+		if n > maxWALRecordSize {
+			return replay, fmt.Errorf("%w: record length %d at offset %d exceeds the limit", ErrCorruptWAL, n, offset)
+		}
+		if int64(n) > int64(len(rest)-walHeaderSize) {
+			// 書きかけの末尾なら、後ろに完全なレコードは続かない（続くなら途中の長さが壊れている）
+			if recordFollows(rest[walHeaderSize:]) {
+				return replay, fmt.Errorf("%w: record length %d at offset %d runs past the end of the log", ErrCorruptWAL, n, offset)
+			}
+			break
+		}
+		end := walHeaderSize + int(n)
+		payload := rest[walHeaderSize:end]
+		if crc32.Checksum(payload, crcTable) != sum {
+			if end == len(rest) {
+				break
+			}
+			return replay, fmt.Errorf("%w: checksum mismatch at offset %d", ErrCorruptWAL, offset)
+		}
+
+		var rec walRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return replay, fmt.Errorf("%w: record at offset %d: %v", ErrCorruptWAL, offset, err)
+		}
+		// 通し番号のない古いレコードは常に適用する
+		if rec.Seq != 0 && rec.Seq <= after {
+			replay.skipped++
+		} else if err := um.applyRecord(rec); err != nil {
+			return replay, fmt.Errorf("%w: record at offset %d: %v", ErrCorruptWAL, offset, err)
+		}
+		offset += int64(end)
+		replay.size = offset
+		replay.records++
+		replay.seq = max(replay.seq, rec.Seq)
+		rest = rest[end:]
+	}
+	return replay, nil
+}
+
+// recordFollows は、data のどこかからチェックサムの合う完全なレコードが始まるかを返す
+// 長さが壊れたレコードと書きかけの末尾のレコードを見分けるために使う
+func recordFollows(data []byte) bool {
+	for i := 0; i+walHeaderSize <= len(data); i++ {
+		n := binary.LittleEndian.Uint32(data[i : i+4])
+		end := i + walHeaderSize + int(n)
+		// レコードのペイロードは JSON のオブジェクトなので、'{' で始まらないものは調べない
+		if n == 0 || n > maxWALRecordSize || end > len(data) || data[i+walHeaderSize] != '{' {
+			continue
+		}
+		if crc32.Checksum(data[i+walHeaderSize:end], crcTable) == binary.LittleEndian.Uint32(data[i+4:i+8]) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRecord は、ログのレコードを反映する（ストアを付ける前にだけ呼ぶ）
+func (um *UserManager) applyRecord(rec walRecord) error {
+	switch rec.Op {
+	case opPut:
+		if rec.User == nil {
+			return errors.New("put without user")
+		}
+		if _, found := um.GetUser(rec.User.ID); found {
+			_, err := um.UpdateUser(rec.User.ID, *rec.User)
+			return err
+		}
+		_, err := um.AddUser(*rec.User)
+		return err
+	case opDelete:
+		// 削除済みでもよい（コンパクションの途中で止まった場合に同じレコードを再生することがある）
+		if _, err := um.DeleteUser(rec.ID); err != nil && !errors.Is(err, ErrUserNotFound) {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown op %q", rec.Op)
+}
+
+// logRecord は、変更を反映する前にログに追記する（um.mu を保持して呼ぶ）
+// ストアがなければ何もしない
+func (um *UserManager) logRecord(rec walRecord) error {
+	s := um.store
+	if s == nil {
+		return nil
+	}
+	if s.wal == nil {
+		return ErrStoreClosed
+	}
+	if s.broken != nil {
+		return s.broken
+	}
+
+	rec.Seq = s.seq + 1
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, walHeaderSize, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	buf = append(buf, payload...)
+
+	_, err = s.wal.Write(buf)
+	if err == nil && !s.opts.NoSync {
+		err = s.wal.Sync()
+	}
+	if err != nil {
+		// 書きかけのレコードを取り除いて、次のレコードが壊れた位置に続かないようにする
+		if terr := s.wal.Truncate(s.size); terr != nil {
+			s.broken = fmt.Errorf("write-ahead log: %w", terr)
+		} else if _, serr := s.wal.Seek(s.size, io.SeekStart); serr != nil {
+			s.broken = fmt.Errorf("write-ahead log: %w", serr)
+		}
+		return fmt.Errorf("write-ahead log: %w", err)
+	}
+	s.size += int64(len(buf))
+	s.seq = rec.Seq
+	s.records++
+	return nil
+}
+
+// afterCommit は、変更を反映した後にレコード数が閾値に達していればコンパクションする（um.mu を保持して呼ぶ）
+// 失敗してもログに残っているので変更は失われない（次の機会に再び試みる）
+func (um *UserManager) afterCommit() {
+	s := um.store
+	if s == nil || s.opts.CompactThreshold < 0 || s.records < s.opts.CompactThreshold {
+		return
+	}
+	um.compactLocked()
+}
+
+// Compact は、現在の状態をスナップショットに書き出し、ログを空にする
+func (um *UserManager) Compact() error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return um.compactLocked()
+}
+
+// compactLocked は、Compact の本体（um.mu を保持して呼ぶ）
+func (um *UserManager) compactLocked() error {
+	s := um.store
+	if s == nil {
+		return nil
+	}
+	if s.wal == nil {
+		return ErrStoreClosed
+	}
+
+	// 1. スナップショットを一時ファイルに書いてから置き換える
+	data, err := json.MarshalIndent(snapshot{Seq: s.seq, NextID: um.nextID, Users: um.users}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, snapshotFileName), data); err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+
+	// 2. スナップショットに含まれたログを空にする
+	// ここで止まっても、ログに残ったレコードは通し番号がスナップショット以下なので再生時に飛ばされる
+	if err := s.wal.Truncate(0); err != nil {
+		return fmt.Errorf("write-ahead log: %w", err)
+	}
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("write-ahead log: %w", err)
+	}
+	if err := s.wal.Sync(); err != nil {
+		return fmt.Errorf("write-ahead log: %w", err)
+	}
+	s.size, s.records, s.broken = 0, 0, nil
+	return nil
+}
+
+// writeFileAtomic は、同じディレクトリの一時ファイルに書いて fsync してから名前を変える
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, bytes.NewReader(data)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	// 名前の変更もディスクに反映する
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// compactPeriodically は、ログにレコードがあれば interval ごとにコンパクションする
+func (um *UserManager) compactPeriodically(interval time.Duration) {
+	s := um.store
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			um.mu.Lock()
+			if s.records > 0 {
+				um.compactLocked()
+			}
+			um.mu.Unlock()
+		}
+	}
+}
+
+// ReplayStats は、起動時にログを再生した結果を返す
+func (um *UserManager) ReplayStats() ReplayStats {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+	if um.store == nil {
+		return ReplayStats{}
+	}
+	return um.store.stats
+}
+
+// Close は、定期的なコンパクションを止め、最後にコンパクションしてからログを閉じる
+// ファイルに永続化していない UserManager では何もしない
+func (um *UserManager) Close() error {
+	s := um.store
+	if s == nil {
+		return nil
+	}
+	um.mu.Lock()
+	if s.closing {
+		um.mu.Unlock()
+		return nil
+	}
+	s.closing = true
+	close(s.stop)
+	um.mu.Unlock()
+	s.wg.Wait()
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	err := um.compactLocked()
+	if cerr := s.wal.Close(); err == nil {
+		err = cerr
+	}
+	s.wal = nil
+	return err
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// openTestStore は、定期的なコンパクションをしないストアを開く
+func openTestStore(t *testing.T, dir string, threshold int) *UserManager {
+	t.Helper()
+	um, err := OpenUserManager(dir, StoreOptions{CompactInterval: -1, CompactThreshold: threshold})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return um
+}
+
+// crash は、コンパクションせずにログを閉じる（プロセスが落ちた状態を再現する）
+func crash(um *UserManager) {
+	um.store.wal.Close()
+}
+
+// mutate は、追加・更新・削除を一通り行う
+func mutate(t *testing.T, um *UserManager) {
+	t.Helper()
+	for _, u := range []User{
+		{Name: "Alice", Email: "alice@example.com"},
+		{Name: "Bob", Email: "bob@example.com"},
+		{ID: 10, Name: "Carol", Email: "carol@example.com"},
+	} {
+		if _, err := um.AddUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := um.UpdateUser(2, User{Name: "Robert", Email: "robert@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := um.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var wantAfterMutate = []User{
+	{ID: 2, Name: "Robert", Email: "robert@example.com"},
+	{ID: 10, Name: "Carol", Email: "carol@example.com"},
+}
+
+func TestStoreReplay(t *testing.T) {
+	dir := t.TempDir()
+	um := openTestStore(t, dir, -1)
+	mutate(t, um)
+	crash(um)
+
+	um = openTestStore(t, dir, -1)
+	defer um.Close()
+	if got := um.GetAllUsers(); !reflect.DeepEqual(got, wantAfterMutate) {
+		t.Errorf("replayed users = %+v, want %+v", got, wantAfterMutate)
+	}
+	if stats := um.ReplayStats(); stats != (ReplayStats{Records: 5}) {
+		t.Errorf("ReplayStats = %+v", stats)
+	}
+	// 削除された ID は再利用しない
+	if u, _ := um.AddUser(User{Name: "Dave", Email: "dave@example.com"}); u.ID != 11 {
+		t.Errorf("Expected ID 11 after replay, got %d", u.ID)
+	}
+	// 再生後のメールアドレスの重複チェック
+	if _, err := um.AddUser(User{Name: "X", Email: "ROBERT@example.com"}); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken, got %v", err)
+	}
+}
+
+func TestStoreCompaction(t *testing.T) {
+	dir := t.TempDir()
+	um := openTestStore(t, dir, -1)
+	mutate(t, um)
+	if err := um.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, walFileName)); info.Size() != 0 {
+		t.Errorf("Expected empty log after compaction, got %d bytes", info.Size())
+	}
+
+	// コンパクション後の変更はログに残る
+	um.AddUser(User{Name: "Dave", Email: "dave@example.com"})
+	crash(um)
+
+	um = openTestStore(t, dir, -1)
+	want := append(wantAfterMutate, User{ID: 11, Name: "Dave", Email: "dave@example.com"})
+	if got := um.GetAllUsers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("users = %+v, want %+v", got, want)
+	}
+	if stats := um.ReplayStats(); stats != (ReplayStats{Snapshot: 2, Records: 1}) {
+		t.Errorf("ReplayStats = %+v", stats)
+	}
+
+	// Close は最後にコンパクションする
+	if err := um.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := um.AddUser(User{Name: "Eve", Email: "eve@example.com"}); !errors.Is(err, ErrStoreClosed) {
+		t.Errorf("Expected ErrStoreClosed, got %v", err)
+	}
+	um = openTestStore(t, dir, -1)
+	defer um.Close()
+	if stats := um.ReplayStats(); stats != (ReplayStats{Snapshot: 3}) {
+		t.Errorf("ReplayStats after Close = %+v", stats)
+	}
+}
+
+func TestStoreCrashBeforeLogTruncate(t *testing.T) {
+	dir := t.TempDir()
+	um := openTestStore(t, dir, -1)
+	// 同じメールアドレスを削除してから使い直すので、ログを二重に適用すると重複エラーになる
+	um.AddUser(User{Name: "u1", Email: "a@example.com"})
+	um.DeleteUser(1)
+	um.AddUser(User{Name: "u2", Email: "a@example.com"})
+
+	// スナップショットを置き換えた後、ログを空にする前に落ちた状態を作る
+	walPath := filepath.Join(dir, walFileName)
+	wal, _ := os.ReadFile(walPath)
+	if err := um.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	crash(um)
+	os.WriteFile(walPath, wal, 0o644)
+
+	um = openTestStore(t, dir, -1)
+	want := []User{{ID: 2, Name: "u2", Email: "a@example.com"}}
+	if got := um.GetAllUsers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("users = %+v, want %+v", got, want)
+	}
+	if stats := um.ReplayStats(); stats != (ReplayStats{Snapshot: 1, Skipped: 3}) {
+		t.Errorf("ReplayStats = %+v", stats)
+	}
+
+	// 通し番号はスナップショットより後から続く
+	um.AddUser(User{Name: "u3", Email: "b@example.com"})
+	crash(um)
+	um = openTestStore(t, dir, -1)
+	defer um.Close()
+	if stats := um.ReplayStats(); stats != (ReplayStats{Snapshot: 1, Records: 1, Skipped: 3}) {
+		t.Errorf("ReplayStats after restart = %+v", stats)
+	}
+	if n := len(um.GetAllUsers()); n != 2 {
+		t.Errorf("Expected 2 users, got %d", n)
+	}
+}
+
+func TestStoreCompactionThreshold(t *testing.T) {
+	dir := t.TempDir()
+	um := openTestStore(t, dir, 2)
+	mutate(t, um)
+	// 5 レコードのうち 4 レコード目でコンパクションされ、残りは 1 レコード
+	if um.store.records != 1 {
+		t.Errorf("Expected 1 record after threshold compaction, got %d", um.store.records)
+	}
+	crash(um)
+
+	um = openTestStore(t, dir, 2)
+	defer um.Close()
+	if got := um.GetAllUsers(); !reflect.DeepEqual(got, wantAfterMutate) {
+		t.Errorf("users = %+v, want %+v", got, wantAfterMutate)
+	}
+}
+
+func TestStoreTruncatedTail(t *testing.T) {
+	dir := t.TempDir()
+	um := openTestStore(t, dir, -1)
+	mutate(t, um)
+	size := um.store.size
+	crash(um)
+
+	walPath := filepath.Join(dir, walFileName)
+	data, _ := os.ReadFile(walPath)
+
+	tests := []struct {
+		name string
+		tail []byte
+	}{
+		{"partial header", []byte{1, 2, 3}},
+		{"partial payload", []byte{100, 0, 0, 0, 1, 2, 3, 4, '{'}},
+		// 最後のレコードのチェックサムが合わないのは書き込み途中のクラッシュ
+		{"bad checksum", []byte{2, 0, 0, 0, 1, 2, 3, 4, '{', '}'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.WriteFile(walPath, append(append([]byte{}, data...), tt.tail...), 0o644)
+
+			um := openTestStore(t, dir, -1)
+			defer crash(um)
+			if got := um.GetAllUsers(); !reflect.DeepEqual(got, wantAfterMutate) {
+				t.Errorf("users = %+v, want %+v", got, wantAfterMutate)
+			}
+			if stats := um.ReplayStats(); stats.Truncated != int64(len(tt.tail)) {
+				t.Errorf("Truncated = %d, want %d", stats.Truncated, len(tt.tail))
+			}
+			if info, _ := os.Stat(walPath); info.Size() != size {
+				t.Errorf("log size = %d, want %d", info.Size(), size)
+			}
+		})
+	}
+}
+
+func TestStoreCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	um := openTestStore(t, dir, -1)
+	mutate(t, um)
+	crash(um)
+
+	// 途中のレコードのペイロードを書き換える
+	walPath := filepath.Join(dir, walFileName)
+	data, _ := os.ReadFile(walPath)
+	data[walHeaderSize+2] ^= 0xff
+	os.WriteFile(walPath, data, 0o644)
+
+	if _, err := OpenUserManager(dir, StoreOptions{CompactInterval: -1}); !errors.Is(err, ErrCorruptWAL) {
+		t.Errorf("Expected ErrCorruptWAL, got %v", err)
+	}
+}
+
+func TestStoreCorruptLength(t *testing.T) {
+	dir := t.TempDir()
+	um := openTestStore(t, dir, -1)
+	mutate(t, um)
+	crash(um)
+
+	walPath := filepath.Join(dir, walFileName)
+	data, _ := os.ReadFile(walPath)
+	second := walHeaderSize + int(binary.LittleEndian.Uint32(data[0:4]))
+
+	// 途中のレコードの長さを書き換えると、後ろのレコードを捨てずにエラーにする
+	for _, i := range []int{1, 2, 3} {
+		corrupt := append([]byte{}, data...)
+		corrupt[second+i] ^= 0xff
+		os.WriteFile(walPath, corrupt, 0o644)
+		if _, err := OpenUserManager(dir, StoreOptions{CompactInterval: -1}); !errors.Is(err, ErrCorruptWAL) {
+			t.Errorf("length byte %d: expected ErrCorruptWAL, got %v", i, err)
+		}
+	}
+}
+
+func TestStoreHTTP(t *testing.T) {
+	dir := t.TempDir()
+	um := openTestStore(t, dir, -1)
+	rr := serve(um, "POST", "/users", `{"name":"Alice","email":"alice@example.com"}`, nil)
+	if rr.Code != 201 {
+		t.Fatalf("POST status = %d: %s", rr.Code, rr.Body.String())
+	}
+	serve(um, "PATCH", "/users/1", `{"name":"Alicia"}`, nil)
+	crash(um)
+
+	um = openTestStore(t, dir, -1)
+	defer um.Close()
+	if u, _ := um.GetUser(1); u.Name != "Alicia" {
+		t.Errorf("Expected patched user to survive restart, got %+v", u)
+	}
+}
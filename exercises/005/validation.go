@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxUserBodyBytes は、1人分のユーザーを送るリクエストボディの上限
+	maxUserBodyBytes = 64 << 10
+	// maxNameLength は、名前の最大文字数
+	maxNameLength = 100
+	// maxEmailLength は、メールアドレスの最大長（RFC 5321）
+	maxEmailLength = 254
+)
+
+// problemTypeValidation は、入力値の検証エラーを表す problem type
+const problemTypeValidation = "/problems/validation-error"
+
+// Problem は、RFC 7807 の problem details
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+}
+
+// InvalidParam は、不正なフィールドとその理由
+type InvalidParam struct {
+	Pointer string `json:"pointer"` // リクエストボディ内の位置（RFC 6901 JSON Pointer）
+	Reason  string `json:"reason"`
+}
+
+// ValidationError は、1つ以上のフィールドが不正なときのエラー
+type ValidationError struct {
+	Params []InvalidParam
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, len(e.Params))
+	for i, p := range e.Params {
+		reasons[i] = p.Pointer + ": " + p.Reason
+	}
+	return "invalid user: " + strings.Join(reasons, ", ")
+}
+
+// writeProblem は、problem details を application/problem+json で返す
+func writeProblem(w http.ResponseWriter, p Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// writeValidationError は、不正なフィールドの一覧を 422 で返す
+func writeValidationError(w http.ResponseWriter, err *ValidationError) {
+	writeProblem(w, Problem{
+		Type:          problemTypeValidation,
+		Title:         "Your request parameters didn't validate.",
+		Status:        http.StatusUnprocessableEntity,
+		InvalidParams: err.Params,
+	})
+}
+
+// readLimitedBody は、上限付きでリクエストボディを読み取る
+// 読み取れなかったときは問題を書き込んで false を返す
+func readLimitedBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must not exceed %d bytes", limit))
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to read request body")
+		return nil, false
+	}
+	return body, true
+}
+
+// decodeUser は、リクエストボディを JSON の User として厳密に読み取って検証する
+// 失敗したときは問題を書き込んで false を返す
+func decodeUser(w http.ResponseWriter, r *http.Request) (User, bool) {
+	return decodeUserWith(w, r, parseUser)
+}
+
+// decodeUserWith は、リクエストボディを parse で User に変換する
+// 失敗したときは問題を書き込んで false を返す
+func decodeUserWith(w http.ResponseWriter, r *http.Request, parse func([]byte) (User, error)) (User, bool) {
+	body, ok := readLimitedBody(w, r, maxUserBodyBytes)
+	if !ok {
+		return User{}, false
+	}
+	user, err := parse(body)
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		writeValidationError(w, validationErr)
+		return User{}, false
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return User{}, false
+	}
+	return user, true
+}
+
+// parseUser は、JSON を未知のフィールドを許さずに User に変換して検証する
+func parseUser(data []byte) (User, error) {
+	var user User
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&user); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return User{}, errors.New("Malformed JSON")
+		}
+		// 未知のフィールドや型の誤りは、読み取れたフィールドの値の検証結果と合わせて一覧にする
+		lenient, params := schemaProblems(data)
+		if len(params) == 0 {
+			return User{}, errors.New("Request body must be a JSON object")
+		}
+		return User{}, &ValidationError{Params: mergeProblems(params, validateUser(lenient))}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return User{}, errors.New("Request body must contain a single JSON object")
+	}
+	if params := validateUser(user); len(params) > 0 {
+		return User{}, &ValidationError{Params: params}
+	}
+	return user, nil
+}
+
+// mergeProblems は、読み取りの問題と validateUser の結果をまとめ、フィールド名の順に並べる
+// 読み取りで問題があったフィールドは、値の検証結果（"is required" など）を重ねて出さない
+func mergeProblems(params, values []InvalidParam) []InvalidParam {
+	for _, p := range values {
+		if !slices.ContainsFunc(params, func(q InvalidParam) bool { return q.Pointer == p.Pointer }) {
+			params = append(params, p)
+		}
+	}
+	slices.SortStableFunc(params, func(a, b InvalidParam) int {
+		return strings.Compare(pointerUnescaper.Replace(a.Pointer), pointerUnescaper.Replace(b.Pointer))
+	})
+	return params
+}
+
+// userFields は、User の JSON フィールド名とその型、userFieldIndex はそのフィールドの番号
+var userFields, userFieldIndex = func() (map[string]reflect.Type, map[string]int) {
+	fields, index := map[string]reflect.Type{}, map[string]int{}
+	t := reflect.TypeOf(User{})
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name], index[name] = t.Field(i).Type, i
+	}
+	return fields, index
+}()
+
+// schemaProblems は、JSON オブジェクトの未知のフィールドと型の誤りを全て返す
+// 型が正しいフィールドだけを読み取った User も返す
+func schemaProblems(data []byte) (User, []InvalidParam) {
+	var user User
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return user, nil
+	}
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var params []InvalidParam
+	for _, name := range names {
+		typ, ok := userFields[name]
+		if !ok {
+			params = append(params, InvalidParam{Pointer: jsonPointer(name), Reason: "unknown field"})
+			continue
+		}
+		value := reflect.New(typ)
+		if err := json.Unmarshal(object[name], value.Interface()); err != nil {
+			params = append(params, InvalidParam{Pointer: jsonPointer(name), Reason: "must be " + jsonTypeName(typ)})
+			continue
+		}
+		reflect.ValueOf(&user).Elem().Field(userFieldIndex[name]).Set(value.Elem())
+	}
+	return user, params
+}
+
+// jsonPointer は、トップレベルのフィールドを指す JSON Pointer を返す
+func jsonPointer(name string) string {
+	name = strings.ReplaceAll(name, "~", "~0")
+	return "/" + strings.ReplaceAll(name, "/", "~1")
+}
+
+// pointerUnescaper は、JSON Pointer のエスケープを元に戻す
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// jsonTypeName は、Go の型に対応するJSONの型の説明を返す
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return "an integer"
+	case reflect.String:
+		return "a string"
+	}
+	return "a " + t.Kind().String()
+}
+
+// validateUser は、フィールドの値を検証して不正なものを全て返す
+func validateUser(u User) []InvalidParam {
+	var params []InvalidParam
+	if u.ID < 0 {
+		params = append(params, InvalidParam{Pointer: "/id", Reason: "must not be negative"})
+	}
+
+	switch name := strings.TrimSpace(u.Name); {
+	case name == "":
+		params = append(params, InvalidParam{Pointer: "/name", Reason: "is required"})
+	case utf8.RuneCountInString(u.Name) > maxNameLength:
+		params = append(params, InvalidParam{Pointer: "/name", Reason: fmt.Sprintf("must be at most %d characters", maxNameLength)})
+	}
+
+	switch {
+	case strings.TrimSpace(u.Email) == "":
+		params = append(params, InvalidParam{Pointer: "/email", Reason: "is required"})
+	case len(u.Email) > maxEmailLength:
+		params = append(params, InvalidParam{Pointer: "/email", Reason: fmt.Sprintf("must be at most %d characters", maxEmailLength)})
+	case !isValidEmail(u.Email):
+		params = append(params, InvalidParam{Pointer: "/email", Reason: "must be a valid email address"})
+	}
+	return params
+}
+
+// isValidEmail は、表示名などを含まない単独のメールアドレスかどうかを返す
+func isValidEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return false
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	return strings.Contains(domain, ".") && !strings.HasSuffix(domain, ".")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateUser(t *testing.T) {
+	tests := []struct {
+		user User
+		want []string // 不正なフィールドの JSON Pointer
+	}{
+		{User{Name: "Alice", Email: "alice@example.com"}, nil},
+		{User{Name: "  ", Email: "alice@example.com"}, []string{"/name"}},
+		{User{Name: strings.Repeat("あ", maxNameLength+1), Email: "alice@example.com"}, []string{"/name"}},
+		{User{Name: "Alice"}, []string{"/email"}},
+		{User{Name: "Alice", Email: "alice"}, []string{"/email"}},
+		{User{Name: "Alice", Email: "alice@localhost"}, []string{"/email"}},
+		{User{Name: "Alice", Email: "Alice <alice@example.com>"}, []string{"/email"}},
+		{User{ID: -1}, []string{"/id", "/name", "/email"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, p := range validateUser(tt.user) {
+			got = append(got, p.Pointer)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("validateUser(%+v) = %v, want %v", tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestCreateUserValidationProblem(t *testing.T) {
+	manager := &UserManager{}
+
+	// 不正なフィールドは全て一覧になる
+	rr := serve(manager, "POST", "/users", `{"name":5,"email":"x","age":30,"a/b":1}`, nil)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Expected Content-Type application/problem+json, got %s", ct)
+	}
+	var problem Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	want := []InvalidParam{
+		{Pointer: "/a~1b", Reason: "unknown field"},
+		{Pointer: "/age", Reason: "unknown field"},
+		{Pointer: "/email", Reason: "must be a valid email address"},
+		{Pointer: "/name", Reason: "must be a string"},
+	}
+	if problem.Type != problemTypeValidation || !reflect.DeepEqual(problem.InvalidParams, want) {
+		t.Errorf("Unexpected problem %+v", problem)
+	}
+
+	// 未知のフィールドがあっても、値の検証結果も一緒に返す
+	rr = serve(manager, "POST", "/users", `{"name":"","email":"bad","extra":1}`, nil)
+	problem = Problem{}
+	json.Unmarshal(rr.Body.Bytes(), &problem)
+	want = []InvalidParam{
+		{Pointer: "/email", Reason: "must be a valid email address"},
+		{Pointer: "/extra", Reason: "unknown field"},
+		{Pointer: "/name", Reason: "is required"},
+	}
+	if rr.Code != http.StatusUnprocessableEntity || !reflect.DeepEqual(problem.InvalidParams, want) {
+		t.Errorf("Unexpected problem %d %+v", rr.Code, problem)
+	}
+
+	// 型が正しければ値の検証結果を返す
+	rr = serve(manager, "POST", "/users", `{"name":"","email":"x"}`, nil)
+	json.Unmarshal(rr.Body.Bytes(), &problem)
+	if rr.Code != http.StatusUnprocessableEntity || len(problem.InvalidParams) != 2 {
+		t.Errorf("Expected 2 invalid params, got %d %+v", rr.Code, problem)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"malformed", `{"name":`, http.StatusBadRequest},
+		{"not an object", `[1]`, http.StatusBadRequest},
+		{"trailing data", `{"name":"A","email":"a@example.com"} {}`, http.StatusBadRequest},
+		{"too large", `{"name":"` + strings.Repeat("a", maxUserBodyBytes) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(manager, "POST", "/users", tt.body, nil)
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Expected Content-Type application/problem+json, got %s", ct)
+			}
+		})
+	}
+	if n := len(manager.GetAllUsers()); n != 0 {
+		t.Errorf("Expected no users to be created, got %d", n)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// defaultPerm は、新しく作るファイルのパーミッション
+const defaultPerm os.FileMode = 0o644
+
+// WriteOption は、WriteToFile の動作を変えるオプション
+type WriteOption func(*writeOptions)
+
+type writeOptions struct {
+	atomic  bool
+	backups int
+	perm    os.FileMode
+}
+
+// Atomic は、同じディレクトリの一時ファイルに書いて fsync してから名前を変えて置き換える
+// 途中でクラッシュしても、対象のファイルは元の内容か新しい内容のどちらかになる
+func Atomic() WriteOption {
+	return func(o *writeOptions) { o.atomic = true }
+}
+
+// WithBackups は、書き込む前の内容を n 世代まで残す
+// 直前の内容が filename.bak、それより古いものが filename.bak.1, filename.bak.2, ... になる
+func WithBackups(n int) WriteOption {
+	return func(o *writeOptions) { o.backups = n }
+}
+
+// WithPerm は、新しく作るファイルのパーミッションを指定する（既定値 0644）
+// 既存のファイルを Atomic で置き換えるときは元のパーミッションを保つ
+func WithPerm(perm os.FileMode) WriteOption {
+	return func(o *writeOptions) { o.perm = perm }
+}
+
+// writeAtomic は、一時ファイル → fsync → rename → ディレクトリの fsync の順に書き込む
+func writeAtomic(filename, content string, o writeOptions) error {
+	// 1. シンボリックリンクならリンク先のファイルを置き換える
+	path := filename
+	if resolved, err := filepath.EvalSymlinks(filename); err == nil {
+		path = resolved
+	}
+
+	// 2. 既存のファイルのパーミッションを引き継ぐ
+	perm := o.perm
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("failed to replace %s: not a regular file", path)
+		}
+		perm = info.Mode().Perm()
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	// 3. 同じディレクトリに一時ファイルを作って書き込む（rename が同じファイルシステム内で済むように）
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.WriteString(content); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	// 4. 名前を変える前に内容をディスクに書き出す
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+
+	// 5. 書き込みが終わってからバックアップを回す（元のファイルはハードリンクで残す）
+	if o.backups > 0 {
+		if err := rotateBackups(path, o.backups, true); err != nil {
+			return err
+		}
+	}
+
+	// 6. 置き換えて、ディレクトリのエントリの変更もディスクに書き出す
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	committed = true
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	return nil
+}
+
+// syncDir は、ディレクトリを fsync して rename などを永続化する
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// backupName は、i 世代前のバックアップのファイル名を返す（0 が最新）
+func backupName(filename string, i int) string {
+	if i == 0 {
+		return filename + ".bak"
+	}
+	return fmt.Sprintf("%s.bak.%d", filename, i)
+}
+
+// rotateBackups は、バックアップを1世代ずつずらし、現在のファイルを filename.bak にする
+// link が true ならコピーの代わりにハードリンクを作る（rename で置き換えるときだけ使える）
+func rotateBackups(filename string, n int, link bool) error {
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	// 1. 一番古いものを消して、残りを1つずつずらす
+	if err := os.Remove(backupName(filename, n-1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove old backup: %w", err)
+	}
+	for i := n - 2; i >= 0; i-- {
+		if err := os.Rename(backupName(filename, i), backupName(filename, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to rotate backup: %w", err)
+		}
+	}
+
+	// 2. 現在の内容を filename.bak に残す
+	bak := backupName(filename, 0)
+	if link {
+		if err := os.Link(filename, bak); err == nil {
+			return nil
+		}
+	}
+	if err := copyContents(filename, bak); err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+	return nil
+}
+
+// copyContents は、src の内容とパーミッションを dst にコピーする
+func copyContents(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
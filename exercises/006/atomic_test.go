@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readString は、ファイルの内容を返す（読めなければテストを失敗させる）
+func readString(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriteToFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.txt")
+
+	// 新しいファイルは WithPerm のパーミッションで作る
+	if err := WriteToFile(path, "v1", Atomic(), WithPerm(0o640)); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(path)
+	if got := readString(t, path); got != "v1" || info.Mode().Perm() != 0o640 {
+		t.Errorf("got %q with mode %v", got, info.Mode().Perm())
+	}
+
+	// 既存のファイルのパーミッションを保つ
+	os.Chmod(path, 0o600)
+	if err := WriteToFile(path, "v2", Atomic()); err != nil {
+		t.Fatal(err)
+	}
+	info, _ = os.Stat(path)
+	if got := readString(t, path); got != "v2" || info.Mode().Perm() != 0o600 {
+		t.Errorf("got %q with mode %v", got, info.Mode().Perm())
+	}
+
+	// 一時ファイルは残らない
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the target file, got %v", entries)
+	}
+}
+
+func TestWriteToFileAtomicSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real.txt")
+	link := filepath.Join(dir, "link.txt")
+	os.WriteFile(target, []byte("old"), 0o644)
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip(err)
+	}
+
+	if err := WriteToFile(link, "new", Atomic()); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Lstat(link); fi.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected the symlink to be kept")
+	}
+	if got := readString(t, target); got != "new" {
+		t.Errorf("target = %q", got)
+	}
+}
+
+func TestWriteToFileAtomicFailure(t *testing.T) {
+	dir := t.TempDir()
+	// ディレクトリは置き換えない
+	if err := WriteToFile(dir, "x", Atomic()); err == nil {
+		t.Error("Expected error when the target is a directory")
+	}
+	if err := WriteToFile(filepath.Join(dir, "missing", "file.txt"), "x", Atomic()); err == nil {
+		t.Error("Expected error when the directory does not exist")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected no leftovers, got %v", entries)
+	}
+}
+
+func TestWriteToFileBackups(t *testing.T) {
+	for _, atomic := range []bool{false, true} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "data.txt")
+		opts := []WriteOption{WithBackups(2)}
+		if atomic {
+			opts = append(opts, Atomic())
+		}
+
+		for _, content := range []string{"v1", "v2", "v3", "v4"} {
+			if err := WriteToFile(path, content, opts...); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		want := map[string]string{
+			"data.txt":       "v4",
+			"data.txt.bak":   "v3",
+			"data.txt.bak.1": "v2",
+		}
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != len(want) {
+			t.Errorf("atomic=%v: files = %v", atomic, entries)
+		}
+		for name, content := range want {
+			if got := readString(t, filepath.Join(dir, name)); got != content {
+				t.Errorf("atomic=%v: %s = %q, want %q", atomic, name, got, content)
+			}
+		}
+	}
+}
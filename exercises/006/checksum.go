@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/md5"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrChecksumMismatch は、コピー先の内容がコピーした内容のハッシュと一致しないことを表す
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// partialSuffix は、Resume() で書きかけの内容を置くファイルの接尾辞
+const partialSuffix = ".partial"
+
+// CopyOption は、CopyFile の動作を変えるオプション
+type CopyOption func(*copyOptions)
+
+type copyOptions struct {
+	hash    crypto.Hash
+	verify  bool
+	sidecar bool
+	resume  bool
+}
+
+// WithHash は、コピーしながら計算するハッシュを選ぶ（既定値 crypto.SHA256）
+func WithHash(h crypto.Hash) CopyOption {
+	return func(o *copyOptions) { o.hash = h }
+}
+
+// Verify は、コピーし終えた後にコピー先を読み直してハッシュを確かめる
+func Verify() CopyOption {
+	return func(o *copyOptions) { o.verify = true }
+}
+
+// WithChecksumFile は、dst.sha256 のような sha256sum 互換のチェックサムファイルを書く
+func WithChecksumFile() CopyOption {
+	return func(o *copyOptions) { o.sidecar = true }
+}
+
+// Resume は、dst.partial に書いてから dst に名前を変える
+// 前回のコピーが途中で止まって dst.partial が残っていれば、コピー元と一致する所まで確かめてから続きをコピーする
+func Resume() CopyOption {
+	return func(o *copyOptions) { o.resume = true }
+}
+
+// checksumExt は、チェックサムファイルの拡張子を返す（SHA-256 → .sha256）
+func checksumExt(h crypto.Hash) string {
+	return "." + strings.ToLower(strings.ReplaceAll(h.String(), "-", ""))
+}
+
+// CopyFileChecksum は、CopyFile と同じようにコピーして、コピーした内容のハッシュを16進数で返す
+func CopyFileChecksum(src, dst string, opts ...CopyOption) (string, error) {
+	o := copyOptions{hash: crypto.SHA256}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !o.hash.Available() {
+		return "", fmt.Errorf("hash %v is not available", o.hash)
+	}
+
+	// 1. os.Open() でソースファイルを開く
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer srcFile.Close()
+
+	// 2. コピー先を開く（Resume なら書きかけのファイルを開いて、一致する所まで確かめる）
+	h := o.hash.New()
+	target := dst
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if o.resume {
+		target = dst + partialSuffix
+		flags = os.O_RDWR | os.O_CREATE
+	}
+	dstFile, err := os.OpenFile(target, flags, 0o666)
+	if err != nil {
+		return "", fmt.Errorf("failed to create destination file: %w", err)
+	}
+	defer dstFile.Close()
+
+	var offset int64
+	if o.resume {
+		if offset, err = verifiedPrefix(srcFile, dstFile, h); err != nil {
+			return "", fmt.Errorf("failed to check partial file: %w", err)
+		}
+		if err := dstFile.Truncate(offset); err != nil {
+			return "", fmt.Errorf("failed to truncate partial file: %w", err)
+		}
+		if _, err := srcFile.Seek(offset, io.SeekStart); err != nil {
+			return "", fmt.Errorf("failed to seek source file: %w", err)
+		}
+		if _, err := dstFile.Seek(offset, io.SeekStart); err != nil {
+			return "", fmt.Errorf("failed to seek partial file: %w", err)
+		}
+	}
+
+	// 3. コピーしながらハッシュを計算する
+	if _, err := io.Copy(io.MultiWriter(dstFile, h), srcFile); err != nil {
+		return "", fmt.Errorf("failed to copy file: %w", err)
+	}
+	sum := h.Sum(nil)
+
+	// 4. Resume なら書き終えてから名前を変える
+	if o.resume {
+		if err := dstFile.Sync(); err != nil {
+			return "", fmt.Errorf("failed to sync file: %w", err)
+		}
+		if err := dstFile.Close(); err != nil {
+			return "", fmt.Errorf("failed to close file: %w", err)
+		}
+		if err := os.Rename(target, dst); err != nil {
+			return "", fmt.Errorf("failed to rename partial file: %w", err)
+		}
+	} else if err := dstFile.Close(); err != nil {
+		return "", fmt.Errorf("failed to close file: %w", err)
+	}
+
+	// 5. コピー先を読み直して確かめる
+	if o.verify {
+		if err := verifyFile(dst, o.hash, sum); err != nil {
+			return "", err
+		}
+	}
+
+	// 6. チェックサムファイルを書く
+	if o.sidecar {
+		line := fmt.Sprintf("%x  %s\n", sum, filepath.Base(dst))
+		if err := WriteToFile(dst+checksumExt(o.hash), line, Atomic()); err != nil {
+			return "", fmt.Errorf("failed to write checksum file: %w", err)
+		}
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+// verifiedPrefix は、書きかけのファイルがコピー元と一致する長さを返す
+// 一致した部分は h に書き込むので、続きをコピーすれば全体のハッシュになる
+func verifiedPrefix(src, partial io.Reader, h io.Writer) (int64, error) {
+	var offset int64
+	want := make([]byte, copyChunkSize)
+	got := make([]byte, copyChunkSize)
+	for {
+		n, err := io.ReadFull(partial, got)
+		if errors.Is(err, io.EOF) {
+			return offset, nil
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+		m, serr := io.ReadFull(src, want[:n])
+		if serr != nil && !errors.Is(serr, io.EOF) && !errors.Is(serr, io.ErrUnexpectedEOF) {
+			return 0, serr
+		}
+		// 食い違う所（コピー元が短くなっていればその位置）で止める
+		same := m
+		if !bytes.Equal(want[:m], got[:m]) {
+			same = 0
+			for want[same] == got[same] {
+				same++
+			}
+		}
+		h.Write(want[:same])
+		offset += int64(same)
+		if same < n {
+			return offset, nil
+		}
+	}
+}
+
+// verifyFile は、ファイルのハッシュが want と一致するかを確かめる
+func verifyFile(path string, hash crypto.Hash, want []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file for verification: %w", err)
+	}
+	defer f.Close()
+	h := hash.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to read file for verification: %w", err)
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		return fmt.Errorf("%w: %s: expected %x, got %x", ErrChecksumMismatch, path, want, got)
+	}
+	return nil
+}
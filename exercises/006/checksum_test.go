@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopyFileChecksum(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.bin"), filepath.Join(dir, "dst.bin")
+	content := strings.Repeat("artifact ", 1000)
+	os.WriteFile(src, []byte(content), 0o644)
+
+	sum, err := CopyFileChecksum(src, dst, Verify(), WithChecksumFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte(content))); sum != want {
+		t.Errorf("sum = %s, want %s", sum, want)
+	}
+	if got := readString(t, dst); got != content {
+		t.Error("Copied content differs")
+	}
+	if got := readString(t, dst+".sha256"); got != sum+"  dst.bin\n" {
+		t.Errorf("checksum file = %q", got)
+	}
+
+	// ハッシュを選べる
+	sum, err = CopyFileChecksum(src, dst, WithHash(crypto.SHA512), WithChecksumFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%x", sha512.Sum512([]byte(content))); sum != want {
+		t.Errorf("sha512 sum = %s, want %s", sum, want)
+	}
+	if _, err := os.Stat(dst + ".sha512"); err != nil {
+		t.Error(err)
+	}
+	if err := CopyFile(src, dst, WithHash(crypto.Hash(0))); err == nil {
+		t.Error("Expected error for unavailable hash")
+	}
+}
+
+func TestVerifyFileMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	os.WriteFile(path, []byte("corrupted"), 0o644)
+	want := sha256.Sum256([]byte("original"))
+	if err := verifyFile(path, crypto.SHA256, want[:]); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestVerifiedPrefix(t *testing.T) {
+	src := strings.Repeat("0123456789", copyChunkSize/4)
+	tests := []struct {
+		name    string
+		partial string
+		want    int
+	}{
+		{"empty", "", 0},
+		{"chunk boundary", src[:copyChunkSize], copyChunkSize},
+		{"mid chunk", src[:copyChunkSize+123], copyChunkSize + 123},
+		{"corrupted tail", src[:copyChunkSize+100] + "xxxx", copyChunkSize + 100},
+		{"longer than source", src + "extra", len(src)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := sha256.New()
+			got, err := verifiedPrefix(strings.NewReader(src), strings.NewReader(tt.partial), h)
+			if err != nil || got != int64(tt.want) {
+				t.Fatalf("verifiedPrefix = %d, %v, want %d", got, err, tt.want)
+			}
+			// 確かめた部分がハッシュに入っている
+			if want := sha256.Sum256([]byte(src[:tt.want])); string(h.Sum(nil)) != string(want[:]) {
+				t.Error("hash does not cover the verified prefix")
+			}
+		})
+	}
+}
+
+func TestCopyFileResume(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.bin"), filepath.Join(dir, "dst.bin")
+	content := strings.Repeat("abcdefgh", copyChunkSize/2)
+	os.WriteFile(src, []byte(content), 0o644)
+
+	// 途中まで書かれて最後が壊れたファイルから再開する
+	os.WriteFile(dst+partialSuffix, []byte(content[:copyChunkSize+10]+"garbage"), 0o644)
+	sum, err := CopyFileChecksum(src, dst, Resume(), Verify())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, dst); got != content {
+		t.Error("Resumed copy differs from source")
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte(content))); sum != want {
+		t.Errorf("sum = %s, want %s", sum, want)
+	}
+	if _, err := os.Stat(dst + partialSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected partial file to be renamed")
+	}
+
+	// 書きかけのファイルがなければ最初からコピーする
+	os.Remove(dst)
+	if err := CopyFile(src, dst, Resume()); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, dst); got != content {
+		t.Error("Fresh copy differs from source")
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+)
+
+// rollingSum は、rsync と同じ弱いローリングチェックサム
+// 窓を1バイトずらしたときの値を O(1) で求められる
+type rollingSum struct {
+	a, b uint32
+	n    uint32 // 窓の大きさ
+}
+
+func newRollingSum(window []byte) rollingSum {
+	s := rollingSum{n: uint32(len(window))}
+	for i, c := range window {
+		s.a += uint32(c)
+		s.b += (s.n - uint32(i)) * uint32(c)
+	}
+	return s
+}
+
+// roll は、窓から out を出して in を入れる
+func (s *rollingSum) roll(out, in byte) {
+	s.a += uint32(in) - uint32(out)
+	s.b += s.a - s.n*uint32(out)
+}
+
+func (s rollingSum) digest() uint32 {
+	return s.a&0xffff | s.b<<16
+}
+
+// blockIndex は、既存のファイルのブロックを弱いチェックサムで引けるようにしたもの
+type blockIndex struct {
+	size   int
+	blocks map[uint32][]blockSig
+}
+
+type blockSig struct {
+	offset int64
+	strong [sha256.Size]byte
+}
+
+// indexBlocks は、basis を blockSize ごとに区切ってチェックサムを求める（端数のブロックは使わない）
+func indexBlocks(basis io.Reader, blockSize int) (*blockIndex, error) {
+	idx := &blockIndex{size: blockSize, blocks: make(map[uint32][]blockSig)}
+	buf := make([]byte, blockSize)
+	for offset := int64(0); ; offset += int64(blockSize) {
+		if _, err := io.ReadFull(basis, buf); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return idx, nil
+			}
+			return nil, err
+		}
+		weak := newRollingSum(buf).digest()
+		idx.blocks[weak] = append(idx.blocks[weak], blockSig{offset: offset, strong: sha256.Sum256(buf)})
+	}
+}
+
+// match は、窓の内容と一致するブロックのうち minOffset 以降にあるものの位置を返す
+// 弱いチェックサムが一致したときだけ強いハッシュを計算する。minOffset ちょうどのブロックがあればそれを優先する
+func (idx *blockIndex) match(weak uint32, window func() []byte, minOffset int64) (int64, bool) {
+	candidates := idx.blocks[weak]
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	strong := sha256.Sum256(window())
+	found := false
+	var best int64
+	for _, sig := range candidates {
+		if sig.offset < minOffset || sig.strong != strong {
+			continue
+		}
+		if sig.offset == minOffset {
+			return sig.offset, true
+		}
+		if !found || sig.offset < best {
+			best, found = sig.offset, true
+		}
+	}
+	return best, found
+}
+
+// deltaStats は、差分転送の内訳
+type deltaStats struct {
+	Literal int64 // 既存のファイルに見つからず、コピー元から書いたバイト数
+	Moved   int64 // 既存のファイルの後ろの方にあったブロックを、前にずらして書いたバイト数
+	Kept    int64 // 既存のファイルの同じ位置にあったので書かなかったバイト数
+}
+
+// maxLiteral は、まとめて書き出す前にためておく、一致しなかったバイトの量
+const maxLiteral = 64 << 10
+
+// deltaPatch は、src を1バイトずつずらしながら dst のブロックを探し、dst をその場で src と同じ内容に書き換える
+// （rsync の --inplace と同じ）。同じ位置に既にあるブロックは書かず、それ以外の所だけを WriteAt で書く
+//
+// 書く位置より前のブロックは既に書き換えているかもしれないので、一致するブロックは書く位置以降にあるものだけを使う。
+// このため、途中にバイトを挿入するとそれより後ろは全て書き直しになる（削除なら後ろのブロックをずらして使える）
+func deltaPatch(src io.Reader, dst io.WriterAt, idx *blockIndex) (deltaStats, int64, error) {
+	var stats deltaStats
+	br := bufio.NewReader(src)
+	n := idx.size
+	ring := make([]byte, n) // 窓（head から始まる循環バッファ）
+	block := make([]byte, n)
+	var literal []byte
+	var pos int64 // 窓の先頭の位置（literal はその直前に書く）
+
+	flush := func() error {
+		_, err := dst.WriteAt(literal, pos-int64(len(literal)))
+		stats.Literal += int64(len(literal))
+		literal = literal[:0]
+		return err
+	}
+	// window は、循環バッファの中身を並べ直して返す
+	head := 0
+	window := func() []byte {
+		copy(block, ring[head:])
+		copy(block[n-head:], ring[:head])
+		return block
+	}
+	// fill は、窓をいっぱいにする（足りなければ読めた分を literal にして false を返す）
+	fill := func() (bool, error) {
+		head = 0
+		m, err := io.ReadFull(br, ring)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			literal = append(literal, ring[:m]...)
+			pos += int64(m)
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	full, err := fill()
+	if err != nil {
+		return stats, pos, err
+	}
+	sum := newRollingSum(ring)
+	for full {
+		if offset, ok := idx.match(sum.digest(), window, pos); ok {
+			// 1. 一致したブロックが同じ位置にあれば書かず、後ろにあれば（block に並べ直した窓の内容を）ずらして書く
+			if err := flush(); err != nil {
+				return stats, pos, err
+			}
+			if offset == pos {
+				stats.Kept += int64(n)
+			} else {
+				if _, err := dst.WriteAt(block, pos); err != nil {
+					return stats, pos, err
+				}
+				stats.Moved += int64(n)
+			}
+			pos += int64(n)
+			if full, err = fill(); err != nil {
+				return stats, pos, err
+			}
+			sum = newRollingSum(ring)
+			continue
+		}
+
+		// 2. 一致しなければ先頭の1バイトを literal にして窓を1バイトずらす
+		c, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			literal = append(literal, window()...)
+			pos += int64(n)
+			break
+		}
+		if err != nil {
+			return stats, pos, err
+		}
+		out := ring[head]
+		literal = append(literal, out)
+		pos++
+		ring[head] = c
+		head = (head + 1) % n
+		sum.roll(out, c)
+		if len(literal) >= maxLiteral {
+			if err := flush(); err != nil {
+				return stats, pos, err
+			}
+		}
+	}
+	return stats, pos, flush()
+}
+
+// deltaCopy は、dst の既存の内容を使い回して、dst をその場で src と同じ内容にする
+// 一時ファイルを使わないので、途中で失敗すると dst は書きかけのまま残る
+// ブロックの一致は SHA-256 で確かめているので、全体のハッシュは改めて確かめない
+func deltaCopy(src, dst string, blockSize int) (deltaStats, error) {
+	out, err := os.OpenFile(dst, os.O_RDWR, 0)
+	if err != nil {
+		return deltaStats{}, err
+	}
+	defer out.Close()
+	idx, err := indexBlocks(bufio.NewReader(out), blockSize)
+	if err != nil {
+		return deltaStats{}, err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return deltaStats{}, err
+	}
+	defer in.Close()
+
+	stats, size, err := deltaPatch(in, out, idx)
+	if err != nil {
+		return stats, err
+	}
+	// 短くなったときは残りを切り捨てる
+	if err := out.Truncate(size); err != nil {
+		return stats, err
+	}
+	return stats, out.Close()
+}
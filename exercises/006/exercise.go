@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"io"
 	"os"
 )
 
@@ -15,16 +14,25 @@ Exercise 006: ファイル操作とエラーハンドリング
    - ファイルにテキストを書き込む
    - ファイルが存在しない場合は作成する
    - エラーが発生した場合は適切に処理する
+   - Atomic() で一時ファイル → fsync → rename → ディレクトリの fsync の順に安全に置き換える
+   - WithBackups(n) で書き込む前の内容を .bak として n 世代残す
+   - 複数のプロセスから書くときは flock(2) でロックする WriteToFileLocked を使う（Lock、TryLock、LockTimeout）
 
 2. ReadFromFile 関数を実装する
    - ファイルからテキストを読み取る
    - ファイルが存在しない場合はエラーを返す
    - 読み取った内容を文字列で返す
+   - 大きすぎるファイルは TooLargeError を返し、BOM を見て UTF-8 に揃える
+   - ReadLines で1行ずつ読む（CRLF と長い行にも対応する）
 
 3. CopyFile 関数を実装する
    - ソースファイルからデスティネーションファイルにコピーする
    - io.Copy を使用する
    - エラーハンドリングを適切に行う
+   - コピーしながら SHA-256 などのハッシュを計算し、Verify() で読み直して確かめる
+   - WithChecksumFile() で sha256sum 互換のチェックサムファイルを書き、Resume() で途中から再開する
+   - CopyTree でディレクトリツリーを丸ごとコピーする（パーミッション・時刻・シンボリックリンク・除外・上書き方針・進み具合・キャンセル）
+   - SyncDir で変わったファイルだけを同期する（大きさと更新時刻かハッシュで比べ、大きなファイルは差分転送する）
 
 期待される動作:
 - WriteToFile("test.txt", "Hello, World!") でファイルに書き込み
@@ -39,8 +47,8 @@ func main() {
 	filename := "test.txt"
 	content := "Hello, World!\nThis is a test file."
 	
-	// ファイルに書き込み
-	err := WriteToFile(filename, content)
+	// ファイルに書き込み（一時ファイル経由で安全に置き換える）
+	err := WriteToFile(filename, content, Atomic())
 	if err != nil {
 		fmt.Printf("Error writing to file: %v\n", err)
 		return
@@ -70,9 +78,24 @@ func main() {
 }
 
 // WriteToFile 関数の実装
-func WriteToFile(filename, content string) error {
-	// 1. os.Create() でファイルを作成
-	file, err := os.Create(filename)
+// Atomic() を渡すと、クラッシュしても書きかけのファイルが残らないように置き換える
+func WriteToFile(filename, content string, opts ...WriteOption) error {
+	o := writeOptions{perm: defaultPerm}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.atomic {
+		return writeAtomic(filename, content, o)
+	}
+	if o.backups > 0 {
+		// 同じファイルを切り詰めて書くので、バックアップはハードリンクではなくコピーにする
+		if err := rotateBackups(filename, o.backups, false); err != nil {
+			return err
+		}
+	}
+
+	// 1. os.OpenFile() でファイルを作成（既にあれば切り詰める）
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, o.perm)
 	if err != nil {
 	    return fmt.Errorf("failed to create file: %w", err)
     }
@@ -91,7 +114,11 @@ func WriteToFile(filename, content string) error {
 }
 
 // ReadFromFile 関数の実装
-func ReadFromFile(filename string) (string, error) {
+// 大きすぎるファイルは TooLargeError を返す（上限は WithMaxSize で変えられる）
+// BOM があれば取り除き、UTF-16 なら UTF-8 に変換して返す
+func ReadFromFile(filename string, opts ...ReadOption) (string, error) {
+	o := newReadOptions(opts)
+
 	// 1. os.Open() でファイルを開く
 	file, err := os.Open(filename)
 	if err != nil {
@@ -101,10 +128,10 @@ func ReadFromFile(filename string) (string, error) {
 	// 2. defer file.Close() でファイルを確実に閉じる
 	defer file.Close()
 
-	// 3. io.ReadAll() で全内容を読み取る
-	data, err := io.ReadAll(file)
+	// 3. 上限までの内容を読み取る
+	data, err := readLimited(file, o.maxSize)
 	if err != nil {
-	    return "", fmt.Errorf("failed to read file: %w", err)
+	    return "", err
 	}
 
 	// 4. []byte を string に変換して返す
@@ -112,28 +139,8 @@ func ReadFromFile(filename string) (string, error) {
 }
 
 // CopyFile 関数の実装
-func CopyFile(src, dst string) error {
-	// 1. os.Open() でソースファイルを開く
-	srcFile, err := os.Open(src)
-	if err != nil {
-		return fmt.Errorf("failed to open source file: %w", err)
-	}
-	defer srcFile.Close()
-	
-	// 2. os.Create() でデスティネーションファイルを作成
-	dstFile, err := os.Create(dst)
-	if err != nil {
-		return fmt.Errorf("failed to create destination file: %w", err)
-	}
-
-	// 3. defer で両方のファイルを閉じる
-	defer dstFile.Close()
-	
-
-	// 4. io.Copy() でファイルをコピー
-	_, err = io.Copy(dstFile, srcFile)
-	if err != nil {
-		return fmt.Errorf("failed to copy file: %w", err)
-	}
-	return nil
-}
\ No newline at end of file
+// コピーしながらハッシュを計算する（WithHash、Verify、WithChecksumFile、Resume で動作を変えられる）
+func CopyFile(src, dst string, opts ...CopyOption) error {
+	_, err := CopyFileChecksum(src, dst, opts...)
+	return err
+}
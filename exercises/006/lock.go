@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLocked は、他のプロセスがロックを持っていて取れなかったことを表す
+var ErrLocked = errors.New("file is locked")
+
+// lockSuffix は、WriteToFileLocked などが使うロックファイルの接尾辞
+// Atomic() は rename でファイルを置き換えるので、対象のファイルそのものではなく別のファイルをロックする
+const lockSuffix = ".lock"
+
+// LockMode は、ロックの種類
+type LockMode int
+
+const (
+	LockShared    LockMode = iota // 共有ロック（読む側、同時に複数持てる）
+	LockExclusive                 // 排他ロック（書く側、1つだけ）
+)
+
+// FileLock は、flock(2) で取った助言ロック
+// 同じプロセスの中でも、別々に取ったロックどうしは競合する
+type FileLock struct {
+	file *os.File
+}
+
+// openLockFile は、ロックに使うファイルを開く（なければ作る）
+func openLockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, defaultPerm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	return f, nil
+}
+
+// acquire は、ロックファイルを開いてロックを取る
+func acquire(path string, mode LockMode, block bool) (*FileLock, error) {
+	f, err := openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := flock(f, mode, block); err != nil {
+		f.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("%w: %s", ErrLocked, path)
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return &FileLock{file: f}, nil
+}
+
+// Lock は、ロックが取れるまで待ってから返す
+func Lock(path string, mode LockMode) (*FileLock, error) {
+	return acquire(path, mode, true)
+}
+
+// TryLock は、待たずにロックを取る（取れなければ ErrLocked を返す）
+func TryLock(path string, mode LockMode) (*FileLock, error) {
+	return acquire(path, mode, false)
+}
+
+// LockTimeout は、timeout までロックを取り直し続ける（取れなければ ErrLocked を返す）
+func LockTimeout(path string, mode LockMode, timeout time.Duration) (*FileLock, error) {
+	deadline := time.Now().Add(timeout)
+	wait := time.Millisecond
+	for {
+		l, err := acquire(path, mode, false)
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("%w: %s: timed out after %v", ErrLocked, path, timeout)
+		}
+		time.Sleep(min(wait, remaining))
+		wait = min(wait*2, 50*time.Millisecond)
+	}
+}
+
+// Unlock は、ロックを外してロックファイルを閉じる
+func (l *FileLock) Unlock() error {
+	if l.file == nil {
+		return nil
+	}
+	err := funlock(l.file)
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.file = nil
+	return err
+}
+
+// WriteToFileLocked は、filename.lock の排他ロックを取ってから WriteToFile で書き込む
+func WriteToFileLocked(filename, content string, opts ...WriteOption) error {
+	l, err := Lock(filename+lockSuffix, LockExclusive)
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+	return WriteToFile(filename, content, opts...)
+}
+
+// ReadFromFileLocked は、filename.lock の共有ロックを取ってから ReadFromFile で読む
+func ReadFromFileLocked(filename string, opts ...ReadOption) (string, error) {
+	l, err := Lock(filename+lockSuffix, LockShared)
+	if err != nil {
+		return "", err
+	}
+	defer l.Unlock()
+	return ReadFromFile(filename, opts...)
+}
+
+// lockRequest は、取りたいロック1つ
+type lockRequest struct {
+	path string
+	mode LockMode
+}
+
+// CopyFileLocked は、src.lock の共有ロックと dst.lock の排他ロックを取ってから CopyFile でコピーする
+// 逆向きのコピーと同時に動いてもデッドロックしないように、パスの順にロックを取る
+func CopyFileLocked(src, dst string, opts ...CopyOption) error {
+	requests := []lockRequest{
+		{filepath.Clean(src) + lockSuffix, LockShared},
+		{filepath.Clean(dst) + lockSuffix, LockExclusive},
+	}
+	switch {
+	case requests[0].path == requests[1].path:
+		requests = requests[1:]
+	case requests[1].path < requests[0].path:
+		requests[0], requests[1] = requests[1], requests[0]
+	}
+	for _, req := range requests {
+		l, err := Lock(req.path, req.mode)
+		if err != nil {
+			return err
+		}
+		defer l.Unlock()
+	}
+	return CopyFile(src, dst, opts...)
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// flock は、flock(2) がない環境では使えない
+func flock(f *os.File, mode LockMode, block bool) error {
+	return errors.ErrUnsupported
+}
+
+// funlock は、flock(2) がない環境では使えない
+func funlock(f *os.File) error {
+	return errors.ErrUnsupported
+}
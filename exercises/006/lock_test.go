@@ -0,0 +1,222 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lockHelperEnv が設定されていると、TestLockHelperProcess が子プロセスとして動く
+const lockHelperEnv = "EXERCISE006_LOCK_HELPER"
+
+// startHelper は、このテストバイナリを子プロセスとして起動する
+func startHelper(t *testing.T, args ...string) (*exec.Cmd, io.WriteCloser, *bufio.Reader) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestLockHelperProcess$", "--"}, args...)...)
+	cmd.Env = append(os.Environ(), lockHelperEnv+"=1")
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stdin.Close()
+		cmd.Wait()
+	})
+	return cmd, stdin, bufio.NewReader(stdout)
+}
+
+// TestLockHelperProcess は、子プロセスとして次のどれかを行う
+//
+//	hold <path> <shared|exclusive>: ロックを取って "locked" を出力し、標準入力が閉じられるまで持ち続ける
+//	write <path> <letter> <n>:      WriteToFileLocked で同じ文字だけの内容を n 回書く
+//	copy <path> <n>:                CopyFileLocked で n 回コピーし、コピーが1種類の文字だけかを確かめる
+func TestLockHelperProcess(t *testing.T) {
+	if os.Getenv(lockHelperEnv) == "" {
+		return
+	}
+	args := os.Args[slices.Index(os.Args, "--")+1:]
+	if err := runLockHelper(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+const helperContentSize = 256 << 10
+
+func runLockHelper(args []string) error {
+	switch args[0] {
+	case "hold":
+		mode := LockShared
+		if args[2] == "exclusive" {
+			mode = LockExclusive
+		}
+		l, err := Lock(args[1], mode)
+		if err != nil {
+			return err
+		}
+		fmt.Println("locked")
+		io.Copy(io.Discard, os.Stdin)
+		return l.Unlock()
+	case "write":
+		n, _ := strconv.Atoi(args[3])
+		content := strings.Repeat(args[2], helperContentSize)
+		for range n {
+			if err := WriteToFileLocked(args[1], content); err != nil {
+				return err
+			}
+		}
+	case "copy":
+		n, _ := strconv.Atoi(args[2])
+		dst := args[1] + ".copy"
+		for range n {
+			err := CopyFileLocked(args[1], dst)
+			if errors.Is(err, os.ErrNotExist) {
+				// まだ誰も書いていない
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			data, err := ReadFromFileLocked(dst)
+			if err != nil {
+				return err
+			}
+			if err := checkUniform(data); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown helper command %q", args[0])
+	}
+	return nil
+}
+
+// checkUniform は、内容が空か、同じ文字だけで決まった長さかを確かめる
+func checkUniform(data string) error {
+	if data == "" {
+		return nil
+	}
+	if len(data) != helperContentSize || strings.Count(data, data[:1]) != len(data) {
+		return fmt.Errorf("interleaved content: %d bytes starting with %q", len(data), data[:1])
+	}
+	return nil
+}
+
+func TestLockAcrossProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.lock")
+
+	// 子プロセスが共有ロックを持っている間は、共有ロックは取れて排他ロックは取れない
+	_, stdin, stdout := startHelper(t, "hold", path, "shared")
+	if line, _ := stdout.ReadString('\n'); line != "locked\n" {
+		t.Fatalf("helper said %q", line)
+	}
+	shared, err := TryLock(path, LockShared)
+	if err != nil {
+		t.Fatalf("Expected shared lock, got %v", err)
+	}
+	shared.Unlock()
+	if _, err := TryLock(path, LockExclusive); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected ErrLocked, got %v", err)
+	}
+
+	// タイムアウトまで取れなければ ErrLocked
+	start := time.Now()
+	if _, err := LockTimeout(path, LockExclusive, 50*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected ErrLocked after timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("LockTimeout returned after %v", elapsed)
+	}
+
+	// 子プロセスが外せば、待っている側が取れる
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		stdin.Close()
+	}()
+	l, err := LockTimeout(path, LockExclusive, 10*time.Second)
+	if err != nil {
+		t.Fatalf("Expected lock after release, got %v", err)
+	}
+
+	// 今度は子プロセスが待たされる
+	cmd2, stdin2, stdout2 := startHelper(t, "hold", path, "exclusive")
+	acquired := make(chan struct{})
+	go func() {
+		stdout2.ReadString('\n')
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Helper acquired the lock while it was held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-acquired:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Helper did not acquire the lock after release")
+	}
+	stdin2.Close()
+	if err := cmd2.Wait(); err != nil {
+		t.Errorf("helper failed: %v", err)
+	}
+}
+
+func TestLockedHelpersAcrossProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.txt")
+	var cmds []*exec.Cmd
+	for _, letter := range []string{"a", "b", "c"} {
+		cmd, _, _ := startHelper(t, "write", path, letter, "20")
+		cmds = append(cmds, cmd)
+	}
+	cmd, _, _ := startHelper(t, "copy", path, "20")
+	cmds = append(cmds, cmd)
+
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("helper %v failed: %v", cmd.Args[3:], err)
+		}
+	}
+	data, err := ReadFromFileLocked(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkUniform(data); err != nil || data == "" {
+		t.Errorf("final content: %v", err)
+	}
+}
+
+func TestCopyFileLockedSamePath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "self.txt")
+	os.WriteFile(path, []byte("self"), 0o644)
+	// 同じパスへのコピーでも自分自身とデッドロックしない
+	done := make(chan error, 1)
+	go func() { done <- CopyFileLocked(path, path) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("CopyFileLocked deadlocked")
+	}
+}
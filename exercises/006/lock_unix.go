@@ -0,0 +1,36 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// flock は、flock(2) でロックを取る（block が false で取れなければ ErrLocked を返す）
+func flock(f *os.File, mode LockMode, block bool) error {
+	how := syscall.LOCK_SH
+	if mode == LockExclusive {
+		how = syscall.LOCK_EX
+	}
+	if !block {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		switch {
+		case errors.Is(err, syscall.EINTR):
+			// シグナルで中断されたら取り直す
+			continue
+		case errors.Is(err, syscall.EWOULDBLOCK):
+			return ErrLocked
+		}
+		return err
+	}
+}
+
+// funlock は、flock(2) で取ったロックを外す
+func funlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
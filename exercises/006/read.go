@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultMaxSize は、ReadFromFile が読むファイルの大きさの上限
+	DefaultMaxSize = 64 << 20
+	// DefaultMaxLineLength は、ReadLines が読む1行の長さの上限
+	DefaultMaxLineLength = 16 << 20
+)
+
+// TooLargeError は、ファイルまたは1行が上限を超えたことを表す
+type TooLargeError struct {
+	Path  string
+	Line  int   // 長すぎた行の番号（ファイル全体が大きすぎたときは 0）
+	Limit int64 // 上限のバイト数
+}
+
+func (e *TooLargeError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s: line %d exceeds %d bytes", e.Path, e.Line, e.Limit)
+	}
+	return fmt.Sprintf("%s: file exceeds %d bytes", e.Path, e.Limit)
+}
+
+// ReadOption は、ReadFromFile と ReadLines の動作を変えるオプション
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	maxSize int64
+	maxLine int64
+}
+
+// WithMaxSize は、ReadFromFile が読むファイルの大きさの上限を変える（負の値なら上限なし）
+func WithMaxSize(n int64) ReadOption {
+	return func(o *readOptions) { o.maxSize = n }
+}
+
+// WithMaxLineLength は、ReadLines が読む1行の長さの上限を変える（負の値なら上限なし）
+func WithMaxLineLength(n int64) ReadOption {
+	return func(o *readOptions) { o.maxLine = n }
+}
+
+func newReadOptions(opts []ReadOption) readOptions {
+	o := readOptions{maxSize: DefaultMaxSize, maxLine: DefaultMaxLineLength}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// readLimited は、最大 limit バイトまで読んで UTF-8 に揃えた内容を返す（超えたら TooLargeError を返す）
+func readLimited(file *os.File, limit int64) ([]byte, error) {
+	var r io.Reader = file
+	if limit >= 0 {
+		// 普通のファイルなら読む前に大きさを確かめる
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() && info.Size() > limit {
+			return nil, &TooLargeError{Path: file.Name(), Limit: limit}
+		}
+		// 読んでいる間に大きくなったときやパイプのために、1バイト多く読めたら上限超えとする
+		r = io.LimitReader(file, limit+1)
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if limit >= 0 && int64(len(raw)) > limit {
+		return nil, &TooLargeError{Path: file.Name(), Limit: limit}
+	}
+	data, err := io.ReadAll(newTextReader(bytes.NewReader(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode file: %w", err)
+	}
+	return data, nil
+}
+
+// ReadLines は、ファイルを1行ずつ読む (行番号, 行) の列を返す
+// 行番号は 1 から始まり、行末の \n と \r\n は取り除く
+// 上限までならどんなに長い行でも読める。読み終えた後のエラーは2つ目の戻り値で取り出す
+func ReadLines(filename string, opts ...ReadOption) (iter.Seq2[int, string], func() error) {
+	o := newReadOptions(opts)
+	var lineErr error
+	seq := func(yield func(int, string) bool) {
+		lineErr = nil
+		file, err := os.Open(filename)
+		if err != nil {
+			lineErr = fmt.Errorf("failed to open file: %w", err)
+			return
+		}
+		defer file.Close()
+
+		br := bufio.NewReader(newTextReader(file))
+		for n := 1; ; n++ {
+			line, err := readTextLine(br, o.maxLine)
+			if errors.Is(err, errLineTooLong) {
+				lineErr = &TooLargeError{Path: filename, Line: n, Limit: o.maxLine}
+				return
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				lineErr = fmt.Errorf("failed to read file: %w", err)
+				return
+			}
+			// 最後の行に改行がなくても1行として返す
+			if len(line) > 0 || err == nil {
+				if !yield(n, string(line)) {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+	return seq, func() error { return lineErr }
+}
+
+var errLineTooLong = errors.New("line too long")
+
+// readTextLine は、改行を除いた1行を返す（最後の行なら io.EOF も返す）
+func readTextLine(br *bufio.Reader, limit int64) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if limit >= 0 && int64(len(line)+len(chunk)) > limit+2 {
+			return nil, errLineTooLong
+		}
+		line = append(line, chunk...)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if limit >= 0 && int64(len(line)) > limit {
+			return nil, errLineTooLong
+		}
+		return line, err
+	}
+}
+
+// newTextReader は、先頭の BOM を見て UTF-8 に揃えた内容を読む Reader を返す
+// UTF-8 の BOM は取り除き、UTF-16 (LE/BE) は UTF-8 に変換する。BOM がなければそのまま読む
+func newTextReader(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(3)
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		br.Discard(3)
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		br.Discard(2)
+		return &utf16Reader{r: br, order: binary.LittleEndian}
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		br.Discard(2)
+		return &utf16Reader{r: br, order: binary.BigEndian}
+	}
+	return br
+}
+
+// utf16Reader は、UTF-16 を読みながら UTF-8 に変換する
+// 対になっていないサロゲートや半端なバイトは U+FFFD にする
+type utf16Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	out   []byte // 変換済みでまだ返していないバイト
+	err   error
+}
+
+func (d *utf16Reader) Read(p []byte) (int, error) {
+	for len(d.out) < len(p) && d.err == nil {
+		d.decode()
+	}
+	n := copy(p, d.out)
+	if n == len(d.out) {
+		d.out = d.out[:0]
+	} else {
+		d.out = d.out[n:]
+	}
+	if n == 0 {
+		return 0, d.err
+	}
+	return n, nil
+}
+
+// decode は、1文字を変換して out に足す
+func (d *utf16Reader) decode() {
+	var b [2]byte
+	if _, err := io.ReadFull(d.r, b[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			d.out = utf8.AppendRune(d.out, utf8.RuneError)
+			err = io.EOF
+		}
+		d.err = err
+		return
+	}
+	r := rune(d.order.Uint16(b[:]))
+	if utf16.IsSurrogate(r) {
+		// 上位サロゲートなら次の2バイトと組み合わせる
+		next, err := d.r.Peek(2)
+		combined := utf8.RuneError
+		if err == nil {
+			combined = utf16.DecodeRune(r, rune(d.order.Uint16(next)))
+		}
+		if combined != utf8.RuneError {
+			d.r.Discard(2)
+		}
+		r = combined
+	}
+	d.out = utf8.AppendRune(d.out, r)
+}
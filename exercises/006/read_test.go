@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 は、BOM 付きの UTF-16 に変換する
+func encodeUTF16(s string, order binary.AppendByteOrder) []byte {
+	data := order.AppendUint16(nil, 0xFEFF)
+	for _, u := range utf16.Encode([]rune(s)) {
+		data = order.AppendUint16(data, u)
+	}
+	return data
+}
+
+func TestReadFromFileMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.txt")
+	os.WriteFile(path, []byte(strings.Repeat("x", 100)), 0o644)
+
+	if _, err := ReadFromFile(path, WithMaxSize(100)); err != nil {
+		t.Errorf("Expected file at the limit to be read, got %v", err)
+	}
+	_, err := ReadFromFile(path, WithMaxSize(99))
+	var tooLarge *TooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 99 || tooLarge.Line != 0 {
+		t.Errorf("Expected TooLargeError, got %v", err)
+	}
+	if _, err := ReadFromFile(path, WithMaxSize(-1)); err != nil {
+		t.Errorf("Expected no limit, got %v", err)
+	}
+}
+
+func TestReadFromFileBOM(t *testing.T) {
+	dir := t.TempDir()
+	text := "こんにちは 🌏\r\nworld"
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"plain", []byte(text)},
+		{"utf-8 bom", append([]byte{0xEF, 0xBB, 0xBF}, text...)},
+		{"utf-16le", encodeUTF16(text, binary.LittleEndian)},
+		{"utf-16be", encodeUTF16(text, binary.BigEndian)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			os.WriteFile(path, tt.data, 0o644)
+			got, err := ReadFromFile(path)
+			if err != nil || got != text {
+				t.Errorf("ReadFromFile = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestUTF16Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.txt")
+	// 対になっていない上位サロゲート、下位サロゲート、半端な1バイト
+	data := []byte{0xFF, 0xFE, 0x3D, 0xD8, 'a', 0, 0x00, 0xDC, 'b'}
+	os.WriteFile(path, data, 0o644)
+	got, err := ReadFromFile(path)
+	if err != nil || got != "�a��" {
+		t.Errorf("ReadFromFile = %q, %v", got, err)
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	dir := t.TempDir()
+	long := strings.Repeat("y", 200000)
+	path := filepath.Join(dir, "lines.txt")
+	os.WriteFile(path, []byte("first\r\n\nthird\r"+"\n"+long+"\nlast"), 0o644)
+
+	lines, errf := ReadLines(path)
+	var got []string
+	var numbers []int
+	for n, line := range lines {
+		numbers = append(numbers, n)
+		got = append(got, line)
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"first", "", "third", long, "last"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %q", got)
+	}
+	if !reflect.DeepEqual(numbers, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("line numbers = %v", numbers)
+	}
+
+	// 途中で止められる
+	count := 0
+	for range lines {
+		count++
+		break
+	}
+	if count != 1 || errf() != nil {
+		t.Errorf("count = %d, err = %v", count, errf())
+	}
+
+	// 長すぎる行
+	lines, errf = ReadLines(path, WithMaxLineLength(1000))
+	count = 0
+	for range lines {
+		count++
+	}
+	var tooLarge *TooLargeError
+	if !errors.As(errf(), &tooLarge) || tooLarge.Line != 4 || count != 3 {
+		t.Errorf("count = %d, err = %v", count, errf())
+	}
+
+	// UTF-16 でも行に分けられる
+	path = filepath.Join(dir, "utf16.txt")
+	os.WriteFile(path, encodeUTF16("一\r\n二\n", binary.LittleEndian), 0o644)
+	lines, errf = ReadLines(path)
+	got = nil
+	for _, line := range lines {
+		got = append(got, line)
+	}
+	if !reflect.DeepEqual(got, []string{"一", "二"}) || errf() != nil {
+		t.Errorf("utf16 lines = %q, %v", got, errf())
+	}
+
+	// 存在しないファイル
+	lines, errf = ReadLines(filepath.Join(dir, "missing.txt"))
+	for range lines {
+		t.Error("Expected no lines")
+	}
+	if errf() == nil {
+		t.Error("Expected error for missing file")
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SyncOp は、SyncDir が行う（DryRun なら行うはずの）変更の種類
+type SyncOp string
+
+const (
+	SyncCreate SyncOp = "create" // コピー先になかったものを作る
+	SyncUpdate SyncOp = "update" // 変わったものを書き直す
+	SyncDelete SyncOp = "delete" // コピー元にないものを消す
+)
+
+const (
+	defaultDeltaMinSize   = 1 << 20
+	defaultDeltaBlockSize = 8 << 10
+)
+
+// SyncOptions は、SyncDir の設定
+// 差分転送はコピー先をその場で書き換えるので、途中で失敗するとそのファイルは書きかけのまま残る
+type SyncOptions struct {
+	Checksum       bool  // 内容のハッシュで変更を調べる（false なら大きさと更新時刻で調べる）
+	Delete         bool  // コピー元にないファイルをコピー先から消す
+	DryRun         bool  // 何も変えずに、変わるはずのものだけを報告する
+	DeltaMinSize   int64 // この大きさ以上のファイルは差分転送する（0 なら 1MiB、負の値なら差分転送しない）
+	DeltaBlockSize int   // 差分転送のブロックの大きさ（0 なら 8KiB）
+}
+
+// SyncChange は、1つのパスに対する変更
+type SyncChange struct {
+	Op      SyncOp
+	Path    string // src または dst からのスラッシュ区切りの相対パス
+	Dir     bool
+	Delta   bool  // 差分転送した（する）
+	Literal int64 // 差分転送でコピー元から書いたバイト数
+	Reused  int64 // 差分転送で既存の内容を使い回したバイト数
+	Written int64 // 差分転送で実際に書いたバイト数（同じ位置にあったブロックは書かない）
+}
+
+func (c SyncChange) String() string {
+	kind := ""
+	switch {
+	case c.Dir:
+		kind = " (dir)"
+	case c.Delta:
+		kind = fmt.Sprintf(" (delta: %d literal, %d reused, %d written)", c.Literal, c.Reused, c.Written)
+	}
+	return fmt.Sprintf("%s %s%s", c.Op, c.Path, kind)
+}
+
+// SyncReport は、SyncDir の結果
+type SyncReport struct {
+	DryRun    bool
+	Changes   []SyncChange
+	Unchanged int // 変わっていなかったファイルとディレクトリの数
+}
+
+func (r *SyncReport) String() string {
+	var sb strings.Builder
+	if r.DryRun {
+		sb.WriteString("dry run: no changes were made\n")
+	}
+	for _, c := range r.Changes {
+		sb.WriteString(c.String())
+		sb.WriteByte('\n')
+	}
+	fmt.Fprintf(&sb, "%d changed, %d unchanged\n", len(r.Changes), r.Unchanged)
+	return sb.String()
+}
+
+// syncer は、1回の SyncDir の状態
+type syncer struct {
+	src, dst string
+	opts     SyncOptions
+	report   *SyncReport
+	seen     map[string]bool // コピー元にあった相対パス
+	dirs     []dirPerm       // 中身を書き終えてからパーミッションを設定するディレクトリ
+	replaced map[string]bool // DryRun で、種類が違うので作り直すはずの相対パス
+}
+
+type dirPerm struct {
+	path string
+	perm fs.FileMode
+}
+
+// SyncDir は、dst を src と同じ内容にする（変わったファイルだけを書き直す）
+// パーミッションと更新時刻も揃えるので、次の呼び出しでは大きさと更新時刻だけで変更を見分けられる
+// 大きなファイルは rsync と同じようにローリングチェックサムでブロックを探し、既存の内容を使い回して書き直す
+func SyncDir(src, dst string, opts SyncOptions) (*SyncReport, error) {
+	if opts.DeltaMinSize == 0 {
+		opts.DeltaMinSize = defaultDeltaMinSize
+	}
+	if opts.DeltaBlockSize <= 0 {
+		opts.DeltaBlockSize = defaultDeltaBlockSize
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("source %s is not a directory", src)
+	}
+	if err := checkOutside(src, dst); err != nil {
+		return nil, err
+	}
+
+	s := &syncer{src: src, dst: dst, opts: opts, report: &SyncReport{DryRun: opts.DryRun}, seen: make(map[string]bool), replaced: make(map[string]bool)}
+	if err := filepath.WalkDir(src, s.visit); err != nil {
+		return s.report, err
+	}
+	// 読み取り専用のディレクトリにも書き込めるように、パーミッションは最後に深い順に設定する
+	for _, d := range slices.Backward(s.dirs) {
+		if err := os.Chmod(d.path, d.perm); err != nil {
+			return s.report, err
+		}
+	}
+	if opts.Delete {
+		if err := s.deleteExtraneous(); err != nil {
+			return s.report, err
+		}
+	}
+	return s.report, nil
+}
+
+// record は、変更を報告に加える
+func (s *syncer) record(c SyncChange) {
+	c.Path = filepath.ToSlash(c.Path)
+	s.report.Changes = append(s.report.Changes, c)
+}
+
+// visit は、コピー元の1つのエントリを同期する
+func (s *syncer) visit(srcPath string, d fs.DirEntry, err error) error {
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(s.src, srcPath)
+	if err != nil {
+		return err
+	}
+	s.seen[rel] = true
+	dstPath := filepath.Join(s.dst, rel)
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+
+	// DryRun で作り直すはずのディレクトリの中は、コピー先を調べずに新しく作るものとして扱う
+	var existing fs.FileInfo
+	if !s.insideReplaced(rel) {
+		existing, err = os.Lstat(dstPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	op := SyncCreate
+	if existing != nil {
+		if existing.Mode().Type() != info.Mode().Type() {
+			// 種類が違うもの（ファイルとディレクトリなど）は消してから作り直す
+			op = SyncUpdate
+			if s.opts.DryRun {
+				s.replaced[rel] = true
+			} else if err := os.RemoveAll(dstPath); err != nil {
+				return err
+			}
+			existing = nil
+		}
+	}
+
+	switch {
+	case d.IsDir():
+		return s.syncDir(dstPath, rel, info, existing, op)
+	case info.Mode().IsRegular():
+		return s.syncFile(srcPath, dstPath, rel, info, existing, op)
+	case info.Mode()&fs.ModeSymlink != 0:
+		return s.syncSymlink(srcPath, dstPath, rel, existing, op)
+	}
+	return fmt.Errorf("cannot sync %s: unsupported file type %v", srcPath, info.Mode().Type())
+}
+
+// insideReplaced は、rel が DryRun で作り直すはずのディレクトリの中にあるかを返す
+func (s *syncer) insideReplaced(rel string) bool {
+	for rel != "." {
+		rel = filepath.Dir(rel)
+		if s.replaced[rel] {
+			return true
+		}
+	}
+	return false
+}
+
+// syncDir は、ディレクトリを作ってパーミッションを揃える
+func (s *syncer) syncDir(dstPath, rel string, info fs.FileInfo, existing fs.FileInfo, op SyncOp) error {
+	if existing != nil {
+		if existing.Mode().Perm() == info.Mode().Perm() {
+			s.report.Unchanged++
+			return nil
+		}
+		op = SyncUpdate
+	}
+	s.record(SyncChange{Op: op, Path: rel, Dir: true})
+	if s.opts.DryRun {
+		return nil
+	}
+	if existing == nil {
+		if err := os.Mkdir(dstPath, 0o700); err != nil {
+			return err
+		}
+	}
+	s.dirs = append(s.dirs, dirPerm{dstPath, info.Mode().Perm()})
+	return nil
+}
+
+// changed は、コピー先のファイルが変わっているかを調べる
+func (s *syncer) changed(srcPath, dstPath string, info, existing fs.FileInfo) (bool, error) {
+	if info.Size() != existing.Size() {
+		return true, nil
+	}
+	if !s.opts.Checksum {
+		return !info.ModTime().Equal(existing.ModTime()), nil
+	}
+	a, err := fileHash(srcPath)
+	if err != nil {
+		return false, err
+	}
+	b, err := fileHash(dstPath)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(a, b), nil
+}
+
+// fileHash は、ファイルの SHA-256 を返す
+func fileHash(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := f.WriteTo(h); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// syncFile は、変わったファイルを一時ファイルに書いてから置き換える
+func (s *syncer) syncFile(srcPath, dstPath, rel string, info fs.FileInfo, existing fs.FileInfo, op SyncOp) error {
+	change := SyncChange{Op: op, Path: rel}
+	if existing != nil {
+		changed, err := s.changed(srcPath, dstPath, info, existing)
+		if err != nil {
+			return err
+		}
+		change.Op = SyncUpdate
+		if !changed {
+			// 内容が同じならパーミッションだけを揃える
+			if info.Mode().Perm() == existing.Mode().Perm() {
+				s.report.Unchanged++
+				return nil
+			}
+			s.record(change)
+			if s.opts.DryRun {
+				return nil
+			}
+			return os.Chmod(dstPath, info.Mode().Perm())
+		}
+		// 差分転送はコピー先を書き込みで開くので、書き込めないファイルは丸ごと置き換える
+		change.Delta = s.opts.DeltaMinSize >= 0 && existing.Size() >= s.opts.DeltaMinSize && existing.Mode().Perm()&0o200 != 0
+	}
+	if s.opts.DryRun {
+		s.record(change)
+		return nil
+	}
+
+	// 1. 大きなファイルは既存の内容を使い回して、変わったブロックだけをその場で書き換える
+	if change.Delta {
+		stats, err := deltaCopy(srcPath, dstPath, s.opts.DeltaBlockSize)
+		if err != nil {
+			return fmt.Errorf("delta transfer of %s failed: %w", rel, err)
+		}
+		change.Literal, change.Reused = stats.Literal, stats.Moved+stats.Kept
+		change.Written = stats.Literal + stats.Moved
+		if err := os.Chmod(dstPath, info.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(dstPath, info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+		s.record(change)
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	// 2. それ以外は一時ファイルに丸ごとコピーし、パーミッションと更新時刻を揃えてから置き換える
+	tmp.Close()
+	if err := CopyFile(srcPath, tmp.Name()); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dstPath); err != nil {
+		return err
+	}
+	committed = true
+	s.record(change)
+	return nil
+}
+
+// syncSymlink は、リンク先が違うシンボリックリンクを作り直す
+func (s *syncer) syncSymlink(srcPath, dstPath, rel string, existing fs.FileInfo, op SyncOp) error {
+	target, err := os.Readlink(srcPath)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if current, err := os.Readlink(dstPath); err == nil && current == target {
+			s.report.Unchanged++
+			return nil
+		}
+		op = SyncUpdate
+	}
+	s.record(SyncChange{Op: op, Path: rel})
+	if s.opts.DryRun {
+		return nil
+	}
+	if existing != nil {
+		if err := os.Remove(dstPath); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(target, dstPath)
+}
+
+// deleteExtraneous は、コピー元になかったものをコピー先から消す（ディレクトリは中身ごと消す）
+func (s *syncer) deleteExtraneous() error {
+	if _, err := os.Stat(s.dst); errors.Is(err, os.ErrNotExist) {
+		// DryRun でコピー先がまだないとき
+		return nil
+	}
+	var extraneous []string
+	err := filepath.WalkDir(s.dst, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dst, p)
+		if err != nil {
+			return err
+		}
+		if s.seen[rel] {
+			// 作り直すはずのディレクトリの中身は、作り直しと一緒に消える
+			if s.replaced[rel] && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		s.record(SyncChange{Op: SyncDelete, Path: rel, Dir: d.IsDir()})
+		extraneous = append(extraneous, p)
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil || s.opts.DryRun {
+		return err
+	}
+	for _, p := range extraneous {
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
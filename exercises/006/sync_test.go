@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// changeList は、報告を "op path" の並びにする
+func changeList(r *SyncReport) []string {
+	var result []string
+	for _, c := range r.Changes {
+		result = append(result, string(c.Op)+" "+c.Path)
+	}
+	return result
+}
+
+func TestSyncDir(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "mirror")
+	writeTree(t, src, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "bb",
+	})
+	os.Chmod(filepath.Join(src, "a.txt"), 0o600)
+
+	// 1回目は全てを作る
+	report, err := SyncDir(src, dst, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"create .", "create a.txt", "create sub", "create sub/b.txt"}
+	if got := changeList(report); !reflect.DeepEqual(got, want) {
+		t.Errorf("first sync = %v, want %v", got, want)
+	}
+	if fi, _ := os.Stat(filepath.Join(dst, "a.txt")); fi.Mode().Perm() != 0o600 {
+		t.Errorf("a.txt mode = %v", fi.Mode().Perm())
+	}
+
+	// 2回目は何も変わらない
+	report, err = SyncDir(src, dst, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Changes) != 0 || report.Unchanged != 4 {
+		t.Errorf("second sync = %v, %d unchanged", changeList(report), report.Unchanged)
+	}
+
+	// 変更、追加、削除
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("A"), 0o600)
+	os.Chtimes(filepath.Join(src, "a.txt"), time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+	os.WriteFile(filepath.Join(src, "c.txt"), []byte("c"), 0o644)
+	os.WriteFile(filepath.Join(dst, "extra.txt"), []byte("x"), 0o644)
+	os.MkdirAll(filepath.Join(dst, "old", "deep"), 0o755)
+
+	// DryRun は何も変えない
+	report, err = SyncDir(src, dst, SyncOptions{Delete: true, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"update a.txt", "create c.txt", "delete extra.txt", "delete old"}
+	if got := changeList(report); !reflect.DeepEqual(got, want) {
+		t.Errorf("dry run = %v, want %v", got, want)
+	}
+	if !strings.Contains(report.String(), "dry run") || !strings.Contains(report.String(), "delete old (dir)") {
+		t.Errorf("report = %s", report)
+	}
+	if got := readString(t, filepath.Join(dst, "a.txt")); got != "a" {
+		t.Error("Dry run modified a.txt")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "extra.txt")); err != nil {
+		t.Error("Dry run deleted extra.txt")
+	}
+
+	report, err = SyncDir(src, dst, SyncOptions{Delete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := changeList(report); !reflect.DeepEqual(got, want) {
+		t.Errorf("sync = %v, want %v", got, want)
+	}
+	wantTree := []string{"a.txt", "c.txt", "sub/", "sub/b.txt"}
+	if got := listTree(t, dst); !reflect.DeepEqual(got, wantTree) {
+		t.Errorf("tree = %v, want %v", got, wantTree)
+	}
+	if got := readString(t, filepath.Join(dst, "a.txt")); got != "A" {
+		t.Errorf("a.txt = %q", got)
+	}
+}
+
+func TestSyncDirChecksum(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"f.txt": "same size 1"})
+	writeTree(t, dst, map[string]string{"f.txt": "same size 2"})
+	// 大きさと更新時刻が同じなら、既定では変わっていないとみなす
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(src, "f.txt"), mtime, mtime)
+	os.Chtimes(filepath.Join(dst, "f.txt"), mtime, mtime)
+
+	report, err := SyncDir(src, dst, SyncOptions{})
+	if err != nil || len(report.Changes) != 0 {
+		t.Fatalf("quick check = %v, %v", changeList(report), err)
+	}
+	report, err = SyncDir(src, dst, SyncOptions{Checksum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := changeList(report); !reflect.DeepEqual(got, []string{"update f.txt"}) {
+		t.Errorf("checksum sync = %v", got)
+	}
+	if got := readString(t, filepath.Join(dst, "f.txt")); got != "same size 1" {
+		t.Errorf("f.txt = %q", got)
+	}
+}
+
+func TestSyncDirDelta(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	data := make([]byte, 256<<10)
+	for i := range data {
+		data[i] = byte(rng.IntN(256))
+	}
+	splice := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+	overwritten := splice(data)
+	copy(overwritten[200000:], "overwritten")
+
+	tests := []struct {
+		name       string
+		changed    []byte
+		maxWritten int64 // 書いてよいバイト数の上限
+	}{
+		// 書き換えたブロックだけを書く
+		{"overwrite", overwritten, 2 * 1024},
+		// 削除より後ろのブロックは前にずらして書く
+		{"delete", splice(data[:100000], data[100008:]), int64(len(data))},
+		// 挿入より後ろは既存のブロックを使えないので書き直しになる
+		{"insert", splice(data[:100000], []byte("inserted"), data[100000:]), int64(len(data)) + 8},
+		{"shrink", data[:200000], 1024},
+		{"grow", splice(data, []byte("appended")), 8},
+	}
+	for _, tt := range tests {
+		src, dst := t.TempDir(), t.TempDir()
+		os.WriteFile(filepath.Join(dst, "big.bin"), data, 0o644)
+		os.WriteFile(filepath.Join(src, "big.bin"), tt.changed, 0o644)
+		later := time.Now().Add(time.Hour)
+		os.Chtimes(filepath.Join(src, "big.bin"), later, later)
+
+		report, err := SyncDir(src, dst, SyncOptions{DeltaMinSize: 1024, DeltaBlockSize: 1024})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(report.Changes) != 1 || !report.Changes[0].Delta {
+			t.Fatalf("%s: changes = %+v", tt.name, report.Changes)
+		}
+		c := report.Changes[0]
+		if c.Literal+c.Reused != int64(len(tt.changed)) || c.Written > tt.maxWritten {
+			t.Errorf("%s: delta had %d literal, %d reused, %d written bytes", tt.name, c.Literal, c.Reused, c.Written)
+		}
+		got, _ := os.ReadFile(filepath.Join(dst, "big.bin"))
+		if !bytes.Equal(got, tt.changed) {
+			t.Errorf("%s: delta transfer produced different content", tt.name)
+		}
+	}
+}
+
+func TestRollingSum(t *testing.T) {
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	const n = 8
+	sum := newRollingSum(data[:n])
+	for i := 1; i+n <= len(data); i++ {
+		sum.roll(data[i-1], data[i+n-1])
+		if want := newRollingSum(data[i : i+n]).digest(); sum.digest() != want {
+			t.Fatalf("offset %d: rolled %08x, want %08x", i, sum.digest(), want)
+		}
+	}
+}
+
+func TestSyncDirErrors(t *testing.T) {
+	src := t.TempDir()
+	if _, err := SyncDir(src, filepath.Join(src, "inner"), SyncOptions{}); err == nil {
+		t.Error("Expected error for destination inside source")
+	}
+	file := filepath.Join(src, "file.txt")
+	os.WriteFile(file, []byte("x"), 0o644)
+	if _, err := SyncDir(file, t.TempDir(), SyncOptions{}); err == nil {
+		t.Error("Expected error for non-directory source")
+	}
+}
+
+func TestSyncDirDryRunReplacedType(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"x/child.txt": "c", "y": "file"})
+	writeTree(t, dst, map[string]string{"x": "file", "y/old.txt": "o"})
+
+	// コピー先の種類が違っても、DryRun はその中を調べずに報告する
+	report, err := SyncDir(src, dst, SyncOptions{DryRun: true, Delete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"update x", "create x/child.txt", "update y"}
+	if got := changeList(report); !reflect.DeepEqual(got, want) {
+		t.Errorf("dry run = %v, want %v", got, want)
+	}
+	if got := readString(t, filepath.Join(dst, "x")); got != "file" {
+		t.Error("Dry run modified x")
+	}
+
+	if _, err := SyncDir(src, dst, SyncOptions{Delete: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := listTree(t, dst); !reflect.DeepEqual(got, []string{"x/", "x/child.txt", "y"}) {
+		t.Errorf("tree = %v", got)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// OverwritePolicy は、コピー先に同じ名前があるときの扱い
+type OverwritePolicy int
+
+const (
+	OverwriteNever   OverwritePolicy = iota // 既存のものは残す
+	OverwriteAlways                         // 常に上書きする
+	OverwriteIfNewer                        // コピー元の更新時刻が新しいときだけ上書きする
+)
+
+// Progress は、コピーの進み具合
+type Progress struct {
+	Files int    // コピーし終えたファイル数（シンボリックリンクを含む）
+	Bytes int64  // コピーしたバイト数
+	Path  string // コピー中またはコピーし終えたファイルの相対パス
+}
+
+// TreeOptions は、CopyTree の設定
+type TreeOptions struct {
+	PreservePerm   bool            // パーミッションを保つ（false なら新しいファイルは 0644、ディレクトリは 0755）
+	PreserveTimes  bool            // 更新時刻を保つ
+	FollowSymlinks bool            // シンボリックリンクをたどってリンク先をコピーする（false ならリンクを作り直す）
+	Skip           []string        // 読み飛ばすパスの glob（相対パスかファイル名のどちらかに一致すればよい）
+	Overwrite      OverwritePolicy // コピー先に同じ名前があるときの扱い
+	Progress       func(Progress)  // 進み具合の通知（nil なら通知しない）
+}
+
+// copyChunkSize は、キャンセルと進み具合を確認する単位
+const copyChunkSize = 256 << 10
+
+// treeCopier は、1回の CopyTree の状態
+type treeCopier struct {
+	ctx      context.Context
+	opts     TreeOptions
+	progress Progress
+	created  []string // この呼び出しで作ったパス（キャンセル時に逆順に消す）
+	dirs     []string // たどっている途中のディレクトリ（シンボリックリンクの循環を検出する）
+}
+
+// CopyTree は、src 以下のディレクトリツリーを dst にコピーする
+// src がファイルならそのファイルだけをコピーする
+// 各ファイルは一時ファイルに書いてから名前を変えるので、書きかけのファイルは dst に現れない
+// ctx がキャンセルされたら、この呼び出しで作ったファイルとディレクトリを消して ctx のエラーを返す
+// （上書きし終えた既存のファイルは元に戻らない）
+func CopyTree(ctx context.Context, src, dst string, opts TreeOptions) error {
+	for _, pattern := range opts.Skip {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid skip pattern %q: %w", pattern, err)
+		}
+	}
+	if err := checkOutside(src, dst); err != nil {
+		return err
+	}
+
+	c := &treeCopier{ctx: ctx, opts: opts}
+	err := c.copyEntry(src, dst, ".")
+	if err != nil && ctx.Err() != nil {
+		c.cleanup()
+	}
+	return err
+}
+
+// checkOutside は、dst が src の中にないことを確かめる（中にあるとコピーしたものを再びコピーしてしまう）
+func checkOutside(src, dst string) error {
+	absSrc, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(absSrc, absDst); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("destination %s is inside source %s", dst, src)
+	}
+	return nil
+}
+
+// cleanup は、この呼び出しで作ったものを新しい順に消す
+func (c *treeCopier) cleanup() {
+	for _, p := range slices.Backward(c.created) {
+		os.Remove(p)
+	}
+}
+
+// skipped は、相対パスが Skip のどれかに一致するかを返す
+func (c *treeCopier) skipped(rel string) bool {
+	if rel == "." {
+		return false
+	}
+	slashed := filepath.ToSlash(rel)
+	for _, pattern := range c.opts.Skip {
+		if ok, _ := path.Match(pattern, slashed); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(slashed)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// report は、進み具合を通知する
+func (c *treeCopier) report(rel string) {
+	if c.opts.Progress != nil {
+		c.progress.Path = rel
+		c.opts.Progress(c.progress)
+	}
+}
+
+// copyEntry は、1つのエントリ（ファイル、ディレクトリ、シンボリックリンク）をコピーする
+func (c *treeCopier) copyEntry(src, dst, rel string) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	if c.skipped(rel) {
+		return nil
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if !c.opts.FollowSymlinks {
+			return c.copySymlink(src, dst, rel, info)
+		}
+		if info, err = os.Stat(src); err != nil {
+			return fmt.Errorf("failed to follow symlink %s: %w", src, err)
+		}
+	}
+
+	switch {
+	case info.IsDir():
+		return c.copyDir(src, dst, rel, info)
+	case info.Mode().IsRegular():
+		return c.copyRegular(src, dst, rel, info)
+	}
+	return fmt.Errorf("cannot copy %s: unsupported file type %v", src, info.Mode().Type())
+}
+
+// copyDir は、ディレクトリを作って中身をコピーする
+func (c *treeCopier) copyDir(src, dst, rel string, info fs.FileInfo) error {
+	// シンボリックリンクをたどって同じディレクトリに戻ってきたら止める
+	for _, ancestor := range c.dirs {
+		if a, err := os.Stat(ancestor); err == nil && os.SameFile(a, info) {
+			return fmt.Errorf("symlink cycle at %s", src)
+		}
+	}
+	c.dirs = append(c.dirs, src)
+	defer func() { c.dirs = c.dirs[:len(c.dirs)-1] }()
+
+	perm := os.FileMode(0o755)
+	if c.opts.PreservePerm {
+		perm = info.Mode().Perm()
+	}
+	existing, err := os.Stat(dst)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// 中身を書き込めるように、パーミッションは最後に設定する
+		if err := os.Mkdir(dst, 0o700); err != nil {
+			return err
+		}
+		c.created = append(c.created, dst)
+	case err != nil:
+		return err
+	case !existing.IsDir():
+		return fmt.Errorf("cannot copy directory %s over non-directory %s", src, dst)
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if err := c.copyEntry(filepath.Join(src, name), filepath.Join(dst, name), filepath.Join(rel, name)); err != nil {
+			return err
+		}
+	}
+
+	// 中身を書き終えてからパーミッションと時刻を設定する（中身を書くと更新時刻が変わるため）
+	if existing == nil || c.opts.PreservePerm {
+		if err := os.Chmod(dst, perm); err != nil {
+			return err
+		}
+	}
+	if c.opts.PreserveTimes {
+		return os.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+// shouldWrite は、上書きの方針に従ってコピー先に書き込むかを返す
+func (c *treeCopier) shouldWrite(dst string, info fs.FileInfo) (exists bool, write bool, err error) {
+	existing, err := os.Lstat(dst)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, true, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	if existing.IsDir() {
+		return true, false, fmt.Errorf("cannot overwrite directory %s", dst)
+	}
+	switch c.opts.Overwrite {
+	case OverwriteAlways:
+		return true, true, nil
+	case OverwriteIfNewer:
+		return true, info.ModTime().After(existing.ModTime()), nil
+	}
+	return true, false, nil
+}
+
+// copySymlink は、シンボリックリンクを同じリンク先で作り直す
+func (c *treeCopier) copySymlink(src, dst, rel string, info fs.FileInfo) error {
+	exists, write, err := c.shouldWrite(dst, info)
+	if err != nil || !write {
+		return err
+	}
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	if err := os.Symlink(target, dst); err != nil {
+		return err
+	}
+	if !exists {
+		c.created = append(c.created, dst)
+	}
+	c.progress.Files++
+	c.report(rel)
+	return nil
+}
+
+// copyRegular は、ファイルを一時ファイルにコピーしてから dst に置き換える
+func (c *treeCopier) copyRegular(src, dst, rel string, info fs.FileInfo) error {
+	exists, write, err := c.shouldWrite(dst, info)
+	if err != nil || !write {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	// 1. 少しずつコピーして、その都度キャンセルを確認して進み具合を通知する
+	buf := make([]byte, copyChunkSize)
+	for {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+		n, rerr := in.Read(buf)
+		if n > 0 {
+			if _, err := tmp.Write(buf[:n]); err != nil {
+				return err
+			}
+			c.progress.Bytes += int64(n)
+			c.report(rel)
+		}
+		if errors.Is(rerr, io.EOF) {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+
+	// 2. パーミッションと時刻を設定してから置き換える
+	perm := defaultPerm
+	if c.opts.PreservePerm {
+		perm = info.Mode().Perm()
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if c.opts.PreserveTimes {
+		if err := os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return err
+	}
+	committed = true
+	if !exists {
+		c.created = append(c.created, dst)
+	}
+
+	c.progress.Files++
+	c.report(rel)
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTree は、相対パス → 内容 のファイルを作る
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// listTree は、root 以下の全てのパスを並べて返す（ディレクトリは末尾に /）
+func listTree(t *testing.T, root string) []string {
+	t.Helper()
+	var paths []string
+	filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, _ := filepath.Rel(root, p)
+		if rel == "." {
+			return nil
+		}
+		if d.IsDir() {
+			rel += "/"
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	slices.Sort(paths)
+	return paths
+}
+
+func TestCopyTree(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	writeTree(t, src, map[string]string{
+		"a.txt":             "a",
+		"sub/b.txt":         "bb",
+		"sub/deep/c.txt":    "ccc",
+		"sub/deep/x.log":    "log",
+		"node_modules/m.js": "m",
+	})
+	os.Chmod(filepath.Join(src, "a.txt"), 0o600)
+	os.Chmod(filepath.Join(src, "sub"), 0o750)
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(filepath.Join(src, "sub/b.txt"), old, old)
+	os.Chtimes(filepath.Join(src, "sub"), old, old)
+	if err := os.Symlink("a.txt", filepath.Join(src, "link")); err != nil {
+		t.Skip(err)
+	}
+
+	var last Progress
+	calls := 0
+	err := CopyTree(context.Background(), src, dst, TreeOptions{
+		PreservePerm:  true,
+		PreserveTimes: true,
+		Skip:          []string{"*.log", "node_modules"},
+		Progress:      func(p Progress) { last = p; calls++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a.txt", "link", "sub/", "sub/b.txt", "sub/deep/", "sub/deep/c.txt"}
+	if got := listTree(t, dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("tree = %v, want %v", got, want)
+	}
+	if last.Files != 4 || last.Bytes != 6 || calls < 4 {
+		t.Errorf("last progress = %+v after %d calls", last, calls)
+	}
+
+	// パーミッションと時刻
+	if fi, _ := os.Stat(filepath.Join(dst, "a.txt")); fi.Mode().Perm() != 0o600 {
+		t.Errorf("a.txt mode = %v", fi.Mode().Perm())
+	}
+	if fi, _ := os.Stat(filepath.Join(dst, "sub")); fi.Mode().Perm() != 0o750 || !fi.ModTime().Equal(old) {
+		t.Errorf("sub mode = %v, mtime = %v", fi.Mode().Perm(), fi.ModTime())
+	}
+	if fi, _ := os.Stat(filepath.Join(dst, "sub/b.txt")); !fi.ModTime().Equal(old) {
+		t.Errorf("b.txt mtime = %v", fi.ModTime())
+	}
+	// シンボリックリンクは作り直す
+	if target, err := os.Readlink(filepath.Join(dst, "link")); err != nil || target != "a.txt" {
+		t.Errorf("link = %q, %v", target, err)
+	}
+}
+
+func TestCopyTreeFollowSymlinks(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	writeTree(t, src, map[string]string{"dir/f.txt": "f"})
+	if err := os.Symlink("dir", filepath.Join(src, "alias")); err != nil {
+		t.Skip(err)
+	}
+
+	if err := CopyTree(context.Background(), src, dst, TreeOptions{FollowSymlinks: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"alias/", "alias/f.txt", "dir/", "dir/f.txt"}
+	if got := listTree(t, dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("tree = %v, want %v", got, want)
+	}
+
+	// 循環するリンクはエラーになる
+	os.Symlink("..", filepath.Join(src, "dir", "up"))
+	err := CopyTree(context.Background(), src, filepath.Join(t.TempDir(), "out"), TreeOptions{FollowSymlinks: true})
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Expected symlink cycle error, got %v", err)
+	}
+}
+
+func TestCopyTreeOverwrite(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"old.txt": "src-old", "new.txt": "src-new"})
+	writeTree(t, dst, map[string]string{"old.txt": "dst-old", "new.txt": "dst-new"})
+	now := time.Now()
+	os.Chtimes(filepath.Join(src, "old.txt"), now.Add(-time.Hour), now.Add(-time.Hour))
+	os.Chtimes(filepath.Join(src, "new.txt"), now.Add(time.Hour), now.Add(time.Hour))
+
+	tests := []struct {
+		policy   OverwritePolicy
+		old, new string
+	}{
+		{OverwriteNever, "dst-old", "dst-new"},
+		{OverwriteIfNewer, "dst-old", "src-new"},
+		{OverwriteAlways, "src-old", "src-new"},
+	}
+	for _, tt := range tests {
+		if err := CopyTree(context.Background(), src, dst, TreeOptions{Overwrite: tt.policy}); err != nil {
+			t.Fatal(err)
+		}
+		if got := readString(t, filepath.Join(dst, "old.txt")); got != tt.old {
+			t.Errorf("policy %d: old.txt = %q, want %q", tt.policy, got, tt.old)
+		}
+		if got := readString(t, filepath.Join(dst, "new.txt")); got != tt.new {
+			t.Errorf("policy %d: new.txt = %q, want %q", tt.policy, got, tt.new)
+		}
+	}
+}
+
+func TestCopyTreeCancel(t *testing.T) {
+	src, dstParent := t.TempDir(), t.TempDir()
+	dst := filepath.Join(dstParent, "out")
+	writeTree(t, src, map[string]string{
+		"a/1.bin": strings.Repeat("x", 3*copyChunkSize),
+		"b/2.bin": strings.Repeat("y", 3*copyChunkSize),
+	})
+	os.MkdirAll(dst, 0o755)
+	writeTree(t, dst, map[string]string{"keep.txt": "keep"})
+
+	// 2つ目のファイルの途中でキャンセルする
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := CopyTree(ctx, src, dst, TreeOptions{Progress: func(p Progress) {
+		if p.Files == 1 && p.Bytes > 3*copyChunkSize {
+			cancel()
+		}
+	}})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	// 元からあったものだけが残る
+	if got := listTree(t, dst); !reflect.DeepEqual(got, []string{"keep.txt"}) {
+		t.Errorf("tree after cancel = %v", got)
+	}
+}
+
+func TestCopyTreeErrors(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"f.txt": "f"})
+
+	if err := CopyTree(context.Background(), src, filepath.Join(src, "inner"), TreeOptions{}); err == nil {
+		t.Error("Expected error for destination inside source")
+	}
+	if err := CopyTree(context.Background(), src, t.TempDir(), TreeOptions{Skip: []string{"["}}); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+	if err := CopyTree(context.Background(), filepath.Join(src, "missing"), t.TempDir(), TreeOptions{}); err == nil {
+		t.Error("Expected error for missing source")
+	}
+
+	// ファイルを1つだけコピーする
+	dst := filepath.Join(t.TempDir(), "copy.txt")
+	if err := CopyTree(context.Background(), filepath.Join(src, "f.txt"), dst, TreeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, dst); got != "f" {
+		t.Errorf("copy.txt = %q", got)
+	}
+}
@@ -26,6 +26,10 @@ Exercise 007: スライス操作とソート
    - 整数スライスから重複を削除する
    - mapを使って重複をチェック
 
+5. ジェネリクスでスライス操作をまとめる
+   - Filter, Map, Reduce, UniqueBy, GroupBy, Partition, Chunk, Window, Zip を実装する
+   - FilterEven, MapSquare, RemoveDuplicates をそれらを使って書き直す
+
 期待される動作:
 - FilterEven([1,2,3,4,5,6]) → [2,4,6]
 - MapSquare([1,2,3,4]) → [1,4,9,16]
@@ -60,32 +64,14 @@ func main() {
 
 // FilterEven 関数の実装
 func FilterEven(numbers []int) []int {
-	// 1. 結果用の空のスライスを作成
-	result := []int{}
-
-	// 2. range でスライスをループ
-	for _, n := range numbers {
-
-	// 3. 偶数の場合（n % 2 == 0）は結果に追加
-	    if n%2 == 0 {
-	                result = append(result, n)
-        }
-    }
-	return result
+	// Filter で偶数（n % 2 == 0）だけを残す
+	return Filter(numbers, func(n int) bool { return n%2 == 0 })
 }
 
 // MapSquare 関数の実装
 func MapSquare(numbers []int) []int {
-	// 1. 同じ長さの結果用スライスを作成：make([]int, len(numbers))
-	result := make([]int, len(numbers))
-
-	// 2. range でスライスをループ
-	for i, n := range numbers {
-
-	// 3. 各要素を二乗して結果に格納
-	    result[i] = n * n
-    }
-	return result
+	// Map で各要素を二乗する
+	return Map(numbers, func(n int) int { return n * n })
 }
 
 // SortByLength 関数の実装
@@ -105,20 +91,6 @@ func SortByLength(words []string) []string {
 
 // RemoveDuplicates 関数の実装
 func RemoveDuplicates(numbers []int) []int {
-	// 1. map[int]bool を作成して重複チェック用
-	seen := make(map[int]bool)
-
-	// 2. 結果用の空のスライスを作成
-	result := []int{}
-
-	// 3. range でスライスをループ
-	for _, n := range numbers {
-
-		// 4. mapに存在しない場合のみ結果に追加し、mapにマーク
-		if !seen[n] {
-			seen[n] = true
-			result = append(result, n)
-		}
-	}
-	return result
-}
\ No newline at end of file
+	// UniqueBy で値そのものをキーにして、最初に現れたものだけを残す
+	return UniqueBy(numbers, func(n int) int { return n })
+}
@@ -0,0 +1,129 @@
+package main
+
+// Pair は、Zip が返す2つの値の組
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+// firstCap は、結果のスライスに最初に確保する容量の上限（小さな確保を何度も繰り返さないため）
+const firstCap = 8
+
+// appendTo は、result に v を足す（result が nil なら、残りの要素数を上限に最初の容量を確保する）
+func appendTo[S ~[]E, E any](result S, v E, remaining int) S {
+	if result == nil {
+		result = make(S, 0, min(remaining, firstCap))
+	}
+	return append(result, v)
+}
+
+// nonNil は、nil なら空のスライスを返す（空のスライスは割り当てを伴わない）
+func nonNil[S ~[]E, E any](s S) S {
+	if s == nil {
+		return S{}
+	}
+	return s
+}
+
+// Filter は、keep が true を返す要素だけを順番に並べた新しいスライスを返す
+// 一致するものがなくても nil ではなく空のスライスを返す（このときは割り当てをしない）
+func Filter[S ~[]E, E any](s S, keep func(E) bool) S {
+	var result S
+	for i, v := range s {
+		if keep(v) {
+			result = appendTo(result, v, len(s)-i)
+		}
+	}
+	return nonNil(result)
+}
+
+// Map は、各要素に f を適用した結果を並べた新しいスライスを返す
+func Map[S ~[]E, E, R any](s S, f func(E) R) []R {
+	result := make([]R, len(s))
+	for i, v := range s {
+		result[i] = f(v)
+	}
+	return result
+}
+
+// Reduce は、init から始めて各要素を f で畳み込んだ結果を返す
+func Reduce[S ~[]E, E, A any](s S, init A, f func(A, E) A) A {
+	acc := init
+	for _, v := range s {
+		acc = f(acc, v)
+	}
+	return acc
+}
+
+// UniqueBy は、key が同じ要素のうち最初に現れたものだけを順番に並べた新しいスライスを返す
+func UniqueBy[S ~[]E, E any, K comparable](s S, key func(E) K) S {
+	seen := make(map[K]struct{})
+	var result S
+	for i, v := range s {
+		k := key(v)
+		if _, ok := seen[k]; !ok {
+			seen[k] = struct{}{}
+			result = appendTo(result, v, len(s)-i)
+		}
+	}
+	return nonNil(result)
+}
+
+// GroupBy は、key ごとに要素をまとめる（グループの中では元の順番を保つ）
+func GroupBy[S ~[]E, E any, K comparable](s S, key func(E) K) map[K]S {
+	groups := make(map[K]S)
+	for _, v := range s {
+		k := key(v)
+		groups[k] = append(groups[k], v)
+	}
+	return groups
+}
+
+// Partition は、pred が true を返す要素と false を返す要素に分ける
+func Partition[S ~[]E, E any](s S, pred func(E) bool) (matched, rest S) {
+	for i, v := range s {
+		if pred(v) {
+			matched = appendTo(matched, v, len(s)-i)
+		} else {
+			rest = appendTo(rest, v, len(s)-i)
+		}
+	}
+	return nonNil(matched), nonNil(rest)
+}
+
+// Chunk は、s を size 個ずつに区切る（最後のものは size より短いことがある）
+// 各チャンクは s と同じ配列を指すが、append しても隣のチャンクを書き換えないように容量を切り詰める
+// size が 1 より小さいときは panic する
+func Chunk[S ~[]E, E any](s S, size int) []S {
+	if size < 1 {
+		panic("Chunk: size must be at least 1")
+	}
+	chunks := make([]S, 0, (len(s)+size-1)/size)
+	for i := 0; i < len(s); i += size {
+		end := min(i+size, len(s))
+		chunks = append(chunks, s[i:end:end])
+	}
+	return chunks
+}
+
+// Window は、1つずつずらした長さ size の窓を全て返す（len(s) が size より短ければ空）
+// 各窓は s と同じ配列を指す。size が 1 より小さいときは panic する
+func Window[S ~[]E, E any](s S, size int) []S {
+	if size < 1 {
+		panic("Window: size must be at least 1")
+	}
+	windows := make([]S, 0, max(len(s)-size+1, 0))
+	for i := 0; i+size <= len(s); i++ {
+		windows = append(windows, s[i:i+size:i+size])
+	}
+	return windows
+}
+
+// Zip は、a と b の同じ位置の要素を組にする（長さは短い方に揃える）
+func Zip[A, B any](a []A, b []B) []Pair[A, B] {
+	pairs := make([]Pair[A, B], min(len(a), len(b)))
+	for i := range pairs {
+		pairs[i] = Pair[A, B]{a[i], b[i]}
+	}
+	return pairs
+}
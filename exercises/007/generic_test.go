@@ -0,0 +1,179 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFilterMapReduce(t *testing.T) {
+	words := []string{"go", "rust", "c", "zig"}
+	if got := Filter(words, func(w string) bool { return len(w) > 1 }); !reflect.DeepEqual(got, []string{"go", "rust", "zig"}) {
+		t.Errorf("Filter = %v", got)
+	}
+	if got := Filter([]string(nil), func(string) bool { return true }); got == nil || len(got) != 0 {
+		t.Errorf("Filter(nil) = %#v, expected empty non-nil slice", got)
+	}
+	if got := Map(words, func(w string) int { return len(w) }); !reflect.DeepEqual(got, []int{2, 4, 1, 3}) {
+		t.Errorf("Map = %v", got)
+	}
+	if got := Reduce(words, "", func(acc, w string) string { return acc + w }); got != "gorustczig" {
+		t.Errorf("Reduce = %q", got)
+	}
+	if got := Reduce([]int{1, 2, 3}, 10, func(acc, n int) int { return acc + n }); got != 16 {
+		t.Errorf("Reduce sum = %d", got)
+	}
+}
+
+func TestUniqueByGroupByPartition(t *testing.T) {
+	words := []string{"Go", "go", "Rust", "GO", "rust", "Zig"}
+	if got := UniqueBy(words, strings.ToLower); !reflect.DeepEqual(got, []string{"Go", "Rust", "Zig"}) {
+		t.Errorf("UniqueBy = %v", got)
+	}
+
+	groups := GroupBy([]int{1, 2, 3, 4, 5, 6, 7}, func(n int) int { return n % 3 })
+	want := map[int][]int{0: {3, 6}, 1: {1, 4, 7}, 2: {2, 5}}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("GroupBy = %v", groups)
+	}
+
+	evens, odds := Partition([]int{1, 2, 3, 4, 5}, func(n int) bool { return n%2 == 0 })
+	if !reflect.DeepEqual(evens, []int{2, 4}) || !reflect.DeepEqual(odds, []int{1, 3, 5}) {
+		t.Errorf("Partition = %v, %v", evens, odds)
+	}
+	evens, odds = Partition([]int{}, func(n int) bool { return true })
+	if evens == nil || odds == nil {
+		t.Error("Expected empty non-nil slices from Partition")
+	}
+}
+
+func TestChunkWindowZip(t *testing.T) {
+	numbers := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		name string
+		got  [][]int
+		want [][]int
+	}{
+		{"chunk 2", Chunk(numbers, 2), [][]int{{1, 2}, {3, 4}, {5}}},
+		{"chunk 5", Chunk(numbers, 5), [][]int{{1, 2, 3, 4, 5}}},
+		{"chunk empty", Chunk([]int{}, 3), [][]int{}},
+		{"window 3", Window(numbers, 3), [][]int{{1, 2, 3}, {2, 3, 4}, {3, 4, 5}}},
+		{"window too long", Window(numbers, 6), [][]int{}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	// チャンクに append しても隣のチャンクは変わらない
+	chunks := Chunk(numbers, 2)
+	_ = append(chunks[0], 99)
+	if chunks[1][0] != 3 || numbers[2] != 3 {
+		t.Error("append to a chunk overwrote its neighbour")
+	}
+
+	for _, size := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected Chunk(%d) to panic", size)
+				}
+			}()
+			Chunk(numbers, size)
+		}()
+	}
+
+	pairs := Zip([]string{"a", "b", "c"}, []int{1, 2})
+	if want := []Pair[string, int]{{"a", 1}, {"b", 2}}; !reflect.DeepEqual(pairs, want) {
+		t.Errorf("Zip = %v", pairs)
+	}
+}
+
+// 以下は、ジェネリクスで書き直す前の実装（割り当て回数を比べるために残す）
+
+func filterEvenLoop(numbers []int) []int {
+	result := []int{}
+	for _, n := range numbers {
+		if n%2 == 0 {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+func mapSquareLoop(numbers []int) []int {
+	result := make([]int, len(numbers))
+	for i, n := range numbers {
+		result[i] = n * n
+	}
+	return result
+}
+
+func removeDuplicatesLoop(numbers []int) []int {
+	seen := make(map[int]bool)
+	result := []int{}
+	for _, n := range numbers {
+		if !seen[n] {
+			seen[n] = true
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// benchInput は、半分ほどが重複する入力を返す
+func benchInput(n int) []int {
+	numbers := make([]int, n)
+	for i := range numbers {
+		numbers[i] = (i * 7919) % (n / 2)
+	}
+	return numbers
+}
+
+var helperPairs = []struct {
+	name    string
+	generic func([]int) []int
+	loop    func([]int) []int
+}{
+	{"FilterEven", FilterEven, filterEvenLoop},
+	{"MapSquare", MapSquare, mapSquareLoop},
+	{"RemoveDuplicates", RemoveDuplicates, removeDuplicatesLoop},
+}
+
+func TestGenericHelpersAllocations(t *testing.T) {
+	inputs := [][]int{{}, {1, 3, 5}, {1, 2, 3}, benchInput(10), benchInput(1000), benchInput(100000)}
+	for _, numbers := range inputs {
+		for _, p := range helperPairs {
+			if !reflect.DeepEqual(p.generic(numbers), p.loop(numbers)) {
+				t.Errorf("%s(%d numbers): generic and loop versions differ", p.name, len(numbers))
+			}
+			generic := testing.AllocsPerRun(10, func() { p.generic(numbers) })
+			loop := testing.AllocsPerRun(10, func() { p.loop(numbers) })
+			if generic > loop {
+				t.Errorf("%s(%d numbers): generic version allocates %v times, loop version %v", p.name, len(numbers), generic, loop)
+			}
+		}
+	}
+}
+
+func BenchmarkHelpers(b *testing.B) {
+	for _, size := range []int{10, 1000, 100000} {
+		numbers := benchInput(size)
+		for _, p := range helperPairs {
+			b.Run(p.name+"/generic/"+strconv.Itoa(size), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					p.generic(numbers)
+				}
+			})
+			b.Run(p.name+"/loop/"+strconv.Itoa(size), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					p.loop(numbers)
+				}
+			})
+		}
+	}
+}